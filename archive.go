@@ -0,0 +1,106 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Source is random access storage holding a WAD archive, such as *bytes.Reader or
+// *io.SectionReader.
+type Source interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// An archive is a single IWAD or PWAD whose lumps have been added to the WAD directory. All reads
+// are offset based, so an archive has no shared cursor.
+type archive struct {
+	name   string
+	r      io.ReaderAt
+	size   int64
+	closer io.Closer // Closed by WAD.Close, or nil if not owned by the WAD
+	header *Header
+	isIWAD bool
+}
+
+// openFileArchive opens an IWAD or PWAD file
+func openFileArchive(filename string) (*archive, error) {
+	logger.Printf("Opening %v ...", filename)
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &archive{name: filename, r: file, size: info.Size(), closer: file}, nil
+}
+
+// openFSArchive opens an IWAD or PWAD in a file system. Files that do not support random access
+// are read into memory.
+func openFSArchive(fsys fs.FS, name string) (*archive, error) {
+	logger.Printf("Opening %v ...", name)
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if r, ok := file.(io.ReaderAt); ok {
+		return &archive{name: name, r: r, size: info.Size(), closer: file}, nil
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &archive{name: name, r: bytes.NewReader(data), size: int64(len(data))}, nil
+}
+
+// readHeader reads and checks the archive header
+func (a *archive) readHeader() error {
+	var binHeader binHeader
+	reader := io.NewSectionReader(a.r, 0, a.size)
+	if err := binary.Read(reader, binary.LittleEndian, &binHeader); err != nil {
+		return fmt.Errorf("%v: %w", a.name, err)
+	}
+	magic := string(binHeader.Magic[:])
+	if magic != "IWAD" && magic != "PWAD" {
+		return fmt.Errorf("%v: bad magic: %s", a.name, binHeader.Magic)
+	}
+	if binHeader.NumLumps < 0 || binHeader.InfoTableOfs < 0 {
+		return fmt.Errorf("%v: bad header", a.name)
+	}
+	a.header = &Header{int(binHeader.NumLumps), int(binHeader.InfoTableOfs)}
+	a.isIWAD = magic == "IWAD"
+	return nil
+}
+
+// closeArchives closes any archives owned by the WAD
+func closeArchives(archives []*archive) error {
+	var firstErr error
+	for _, a := range archives {
+		if a.closer == nil {
+			continue
+		}
+		if err := a.closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		a.closer = nil
+	}
+	return firstErr
+}
+
+// Close releases any files opened by the WAD. Data already loaded remains usable.
+func (w *WAD) Close() error {
+	return closeArchives(w.archives)
+}
@@ -0,0 +1,313 @@
+package wad
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// BlockSize is the width and height of a block map block in map units
+const BlockSize = 128
+
+// PathFlags selects what PathTraverse reports, as the PT_ flags of Doom's P_PathTraverse do
+type PathFlags int
+
+const (
+	PathAddLines  PathFlags = 1 << iota // Report the lines crossed
+	PathAddThings                       // Report the things crossed
+	PathEarlyOut                        // Give up at the first one-sided line crossed
+)
+
+// Intercept is a line or thing crossed by a path
+type Intercept struct {
+	Frac  float64 // Fraction of the way along the path, from 0 at the start to 1 at the end
+	Line  *Line   // The line crossed, or nil for a thing
+	Thing *Thing  // The thing crossed, or nil for a line
+}
+
+// BuildBlockMap builds the level's block map from its lines and vertexes. The origin is the
+// bottom left corner of the map, rounded down to a multiple of 8 as the original node builder did,
+// and each block lists the lines that touch it, in line order.
+func BuildBlockMap(level *Level) error {
+	if len(level.Vertexes) == 0 {
+		return errors.New("no vertexes to build a block map from")
+	}
+	bbox := newBBox()
+	for _, v := range level.Vertexes {
+		bbox.add(v)
+	}
+	blockMap := BlockMap{
+		OriginX: math.Floor(bbox.Left/8) * 8,
+		OriginY: math.Floor(bbox.Bottom/8) * 8,
+	}
+	blockMap.NumColumns = int((bbox.Right-blockMap.OriginX)/BlockSize) + 1
+	blockMap.NumRows = int((bbox.Top-blockMap.OriginY)/BlockSize) + 1
+	if blockMap.NumColumns*blockMap.NumRows > math.MaxUint16 {
+		return fmt.Errorf("map too large for a block map: %v by %v blocks", blockMap.NumColumns,
+			blockMap.NumRows)
+	}
+	blockMap.Blocks = make([]Block, blockMap.NumColumns*blockMap.NumRows)
+
+	for i, line := range level.Lines {
+		if !level.validVertexes(&line) {
+			return fmt.Errorf("line %v: bad vertex", i)
+		}
+		v1, v2 := level.Vertexes[line.V1Num], level.Vertexes[line.V2Num]
+		left := int((min(v1.X, v2.X) - blockMap.OriginX) / BlockSize)
+		right := int((max(v1.X, v2.X) - blockMap.OriginX) / BlockSize)
+		bottom := int((min(v1.Y, v2.Y) - blockMap.OriginY) / BlockSize)
+		top := int((max(v1.Y, v2.Y) - blockMap.OriginY) / BlockSize)
+		for y := bottom; y <= top; y++ {
+			for x := left; x <= right; x++ {
+				if lineTouchesBlock(v1, v2, blockMap.OriginX+float64(x*BlockSize),
+					blockMap.OriginY+float64(y*BlockSize)) {
+					b := blockMap.Block(x, y)
+					b.LineNums = append(b.LineNums, i)
+					b.Lines = append(b.Lines, &level.Lines[i])
+				}
+			}
+		}
+	}
+
+	level.BlockMap = blockMap
+	return nil
+}
+
+// lineTouchesBlock reports whether the line from v1 to v2 touches the block with its bottom left
+// corner at x, y, edges included. The block is known to overlap the line's bounding box, so the
+// line touches it unless all four corners are strictly on the same side.
+func lineTouchesBlock(v1, v2 Vertex, x, y float64) bool {
+	dx, dy := v2.X-v1.X, v2.Y-v1.Y
+	left, right := false, false
+	for _, c := range [4][2]float64{{x, y}, {x + BlockSize, y}, {x, y + BlockSize},
+		{x + BlockSize, y + BlockSize}} {
+		side := dx*(c[1]-v1.Y) - dy*(c[0]-v1.X)
+		left = left || side >= 0
+		right = right || side <= 0
+	}
+	return left && right
+}
+
+// EncodeBlockMap serializes the level's block map as a BLOCKMAP lump. Each block list starts with
+// the 0 that vanilla Doom expects and ends with -1, and blocks with identical lists share a single
+// copy of the list.
+func (l *Level) EncodeBlockMap() (Lump, error) {
+	b := &l.BlockMap
+	if len(b.Blocks) != b.NumColumns*b.NumRows {
+		return Lump{}, fmt.Errorf("block map has %v blocks, but is %v by %v", len(b.Blocks),
+			b.NumColumns, b.NumRows)
+	}
+	header := binBlockMapHeader{
+		OriginX: int16(b.OriginX),
+		OriginY: int16(b.OriginY),
+		Columns: int16(b.NumColumns),
+		Rows:    int16(b.NumRows),
+	}
+
+	// Offsets count int16s from the start of the lump
+	offsets := make([]binBlockListOffset, len(b.Blocks))
+	var lists []binBlockLineNum
+	listOffsets := map[string]int{}
+	start := 4 + len(b.Blocks)
+	for i, block := range b.Blocks {
+		list := []binBlockLineNum{0}
+		for _, n := range block.LineNums {
+			list = append(list, binBlockLineNum(n))
+		}
+		list = append(list, 0xffff)
+
+		key := string(encode(list))
+		offset, ok := listOffsets[key]
+		if !ok {
+			offset = start + len(lists)
+			listOffsets[key] = offset
+			lists = append(lists, list...)
+		}
+		if offset > math.MaxUint16 {
+			return Lump{}, errors.New("block map too large: offsets exceed 16 bits")
+		}
+		offsets[i] = binBlockListOffset(uint16(offset))
+	}
+
+	data := slices.Concat(encode(header), encode(offsets), encode(lists))
+	return Lump{Name: "BLOCKMAP", Data: data}, nil
+}
+
+// BlockAt returns the block containing a point in map coordinates, or nil if the point is outside
+// the block map
+func (b *BlockMap) BlockAt(x, y float64) *Block {
+	column, row := b.blockCoords(x, y)
+	if !b.inside(column, row) {
+		return nil
+	}
+	return b.Block(column, row)
+}
+
+// LinesInBox returns the lines listed in the blocks that overlap a bounding box in map
+// coordinates, each once, in the order found, as P_BlockLinesIterator finds the lines near a
+// thing. The lines may not themselves touch the box.
+func (b *BlockMap) LinesInBox(bbox BoundBox) []*Line {
+	left, bottom := b.blockCoords(bbox.Left, bbox.Bottom)
+	right, top := b.blockCoords(bbox.Right, bbox.Top)
+	left, bottom = max(left, 0), max(bottom, 0)
+	right, top = min(right, b.NumColumns-1), min(top, b.NumRows-1)
+
+	found := map[*Line]bool{}
+	var lines []*Line
+	for row := bottom; row <= top; row++ {
+		for column := left; column <= right; column++ {
+			for _, line := range b.Block(column, row).Lines {
+				if !found[line] {
+					found[line] = true
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// blockCoords returns the column and row of the block containing a point in map coordinates,
+// which may be outside the block map
+func (b *BlockMap) blockCoords(x, y float64) (int, int) {
+	return int(math.Floor((x - b.OriginX) / BlockSize)), int(math.Floor((y - b.OriginY) / BlockSize))
+}
+
+// inside reports whether a column and row are in the block map
+func (b *BlockMap) inside(column, row int) bool {
+	return column >= 0 && column < b.NumColumns && row >= 0 && row < b.NumRows &&
+		row*b.NumColumns+column < len(b.Blocks)
+}
+
+// PathTraverse calls fn for the lines and things crossed by the path from x1, y1 to x2, y2, in
+// order along the path, as Doom's P_PathTraverse does for hitscan attacks and using lines. Lines
+// and things are found in the blocks the path passes through, so a thing is only found if its
+// center is in one of them, as in Doom. A thing is crossed if the path crosses the diagonal of its
+// square that is most nearly square on to the path, using its Radius. With PathEarlyOut, it
+// returns false without calling fn if the path crosses a line with no back sector. Otherwise it
+// returns false if fn does, stopping the traversal, or true.
+func (l *Level) PathTraverse(x1, y1, x2, y2 float64, flags PathFlags,
+	fn func(*Intercept) bool) bool {
+	b := &l.BlockMap
+	checked := map[*Line]bool{}
+	trace := &Node{X: x1, Y: y1, DX: x2 - x1, DY: y2 - y1}
+	var intercepts []Intercept
+	var blocks []int
+
+	// Step through the blocks the path passes through, one edge crossing at a time
+	column, row := b.blockCoords(x1, y1)
+	endColumn, endRow := b.blockCoords(x2, y2)
+	stepX, stepY := 1, 1
+	if x2 < x1 {
+		stepX = -1
+	}
+	if y2 < y1 {
+		stepY = -1
+	}
+	edgeX := func(c int) float64 { return b.OriginX + float64(c+max(stepX, 0))*BlockSize }
+	edgeY := func(r int) float64 { return b.OriginY + float64(r+max(stepY, 0))*BlockSize }
+	for range abs(endColumn-column) + abs(endRow-row) + 1 {
+		if b.inside(column, row) {
+			blocks = append(blocks, row*b.NumColumns+column)
+			if flags&PathAddLines != 0 {
+				for _, line := range b.Block(column, row).Lines {
+					if checked[line] {
+						continue
+					}
+					checked[line] = true
+					frac, crossed := l.lineIntercept(trace, line)
+					if !crossed {
+						continue
+					}
+					if flags&PathEarlyOut != 0 && frac < 1 && line.BackSector == nil {
+						return false
+					}
+					intercepts = append(intercepts, Intercept{Frac: frac, Line: line})
+				}
+			}
+		}
+		if column == endColumn && row == endRow {
+			break
+		}
+
+		// Cross whichever edge of the block the path reaches first
+		tx, ty := math.Inf(1), math.Inf(1)
+		if column != endColumn {
+			tx = (edgeX(column) - x1) / trace.DX
+		}
+		if row != endRow {
+			ty = (edgeY(row) - y1) / trace.DY
+		}
+		if tx <= ty {
+			column += stepX
+		} else {
+			row += stepY
+		}
+	}
+
+	if flags&PathAddThings != 0 {
+		slices.Sort(blocks)
+		for i := range l.Things {
+			t := &l.Things[i]
+			column, row := b.blockCoords(float64(t.X), float64(t.Y))
+			if !b.inside(column, row) {
+				continue
+			}
+			if _, found := slices.BinarySearch(blocks, row*b.NumColumns+column); !found {
+				continue
+			}
+			if frac, crossed := l.thingIntercept(trace, t); crossed {
+				intercepts = append(intercepts, Intercept{Frac: frac, Thing: t})
+			}
+		}
+	}
+
+	slices.SortStableFunc(intercepts, func(a, b Intercept) int { return cmp.Compare(a.Frac, b.Frac) })
+	for i := range intercepts {
+		if intercepts[i].Frac > 1 {
+			break
+		}
+		if !fn(&intercepts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lineIntercept returns the fraction along a path at which it crosses a line, and whether it
+// crosses it ahead of the start, as PIT_AddLineIntercepts decides. For a short path, the line
+// is crossed if the ends of the path are on its opposite sides, and for a longer one, if the
+// ends of the line are on opposite sides of the path.
+func (l *Level) lineIntercept(trace *Node, line *Line) (float64, bool) {
+	v1, v2 := line.V1, line.V2
+	var s1, s2 int
+	if math.Abs(trace.DX) > 16 || math.Abs(trace.DY) > 16 {
+		s1, s2 = l.pointOnSide(trace, v1.X, v1.Y), l.pointOnSide(trace, v2.X, v2.Y)
+	} else {
+		divline := &Node{X: v1.X, Y: v1.Y, DX: v2.X - v1.X, DY: v2.Y - v1.Y}
+		s1 = l.pointOnSide(divline, trace.X, trace.Y)
+		s2 = l.pointOnSide(divline, trace.X+trace.DX, trace.Y+trace.DY)
+	}
+	if s1 == s2 {
+		return 0, false
+	}
+	frac := intercept(trace.X, trace.Y, trace.DX, trace.DY, v1.X, v1.Y, v2.X-v1.X, v2.Y-v1.Y)
+	return frac, frac >= 0
+}
+
+// thingIntercept returns the fraction along a path at which it crosses a thing, and whether it
+// crosses it ahead of the start, as PIT_AddThingIntercepts decides
+func (l *Level) thingIntercept(trace *Node, t *Thing) (float64, bool) {
+	x, y, r := float64(t.X), float64(t.Y), t.Radius()
+	x1, y1, x2, y2 := x-r, y-r, x+r, y+r
+	if (trace.DX > 0) == (trace.DY > 0) {
+		y1, y2 = y2, y1
+	}
+	if l.pointOnSide(trace, x1, y1) == l.pointOnSide(trace, x2, y2) {
+		return 0, false
+	}
+	frac := intercept(trace.X, trace.Y, trace.DX, trace.DY, x1, y1, x2-x1, y2-y1)
+	return frac, frac >= 0
+}
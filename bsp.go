@@ -0,0 +1,235 @@
+package wad
+
+import (
+	"iter"
+	"math"
+)
+
+// PointOnSide returns the side of the node's partition line that a point is on, as for Child: 0
+// for the right, or front, and 1 for the left, or back. Ties are broken as vanilla Doom's
+// R_PointOnSide breaks them, so that points on the line are usually on the back.
+func (n *Node) PointOnSide(x, y float64) int {
+	if n.DX == 0 {
+		if x <= n.X {
+			return boolToSide(n.DY > 0)
+		}
+		return boolToSide(n.DY < 0)
+	}
+	if n.DY == 0 {
+		if y <= n.Y {
+			return boolToSide(n.DX < 0)
+		}
+		return boolToSide(n.DX > 0)
+	}
+	dx, dy := x-n.X, y-n.Y
+
+	// Decide by signs if the cross products differ in sign, as vanilla does
+	if math.Signbit(n.DY) != math.Signbit(n.DX) != math.Signbit(dx) != math.Signbit(dy) {
+		return boolToSide(math.Signbit(n.DY) != math.Signbit(dx))
+	}
+	left, right := n.DY*dx, dy*n.DX
+	return boolToSide(right >= left)
+}
+
+// PointOnSideFixed is PointOnSide computed exactly as vanilla Doom computes it, in 16.16 fixed
+// point with the partition line's direction truncated to whole units. Coordinates are rounded to
+// the nearest 1/65536.
+func (n *Node) PointOnSideFixed(x, y float64) int {
+	nx, ny := floatToFixed(n.X), floatToFixed(n.Y)
+	ndx, ndy := floatToFixed(n.DX), floatToFixed(n.DY)
+	fx, fy := floatToFixed(x), floatToFixed(y)
+	if ndx == 0 {
+		if fx <= nx {
+			return boolToSide(ndy > 0)
+		}
+		return boolToSide(ndy < 0)
+	}
+	if ndy == 0 {
+		if fy <= ny {
+			return boolToSide(ndx < 0)
+		}
+		return boolToSide(ndx > 0)
+	}
+	dx, dy := fx-nx, fy-ny // Wraps on overflow, as in C
+	if (ndy ^ ndx ^ dx ^ dy) < 0 {
+		return boolToSide((ndy ^ dx) < 0)
+	}
+	left := fixedMul(ndy>>16, dx)
+	right := fixedMul(dy, ndx>>16)
+	return boolToSide(right >= left)
+}
+
+// fixedMul multiplies 16.16 fixed point numbers, as Doom's FixedMul does
+func fixedMul(a, b int32) int32 {
+	return int32(int64(a) * int64(b) >> 16)
+}
+
+// boolToSide converts true to the back side, 1, and false to the front side, 0
+func boolToSide(back bool) int {
+	if back {
+		return 1
+	}
+	return 0
+}
+
+// SubSectorAt returns the subsector containing a point, found by descending the BSP tree from
+// the root node as R_PointInSubsector does. Sides are found with PointOnSideFixed if the level's
+// FixedPoint is set, or else PointOnSide. It returns nil if the level has no subsectors or its
+// tree is broken.
+func (l *Level) SubSectorAt(x, y float64) *SubSector {
+	if len(l.SubSectors) == 0 {
+		return nil
+	}
+	if len(l.Nodes) == 0 {
+		return &l.SubSectors[0]
+	}
+	child := len(l.Nodes) - 1
+	for range len(l.Nodes) { // A tree can be no deeper than its number of nodes
+		if child < 0 {
+			if child&math.MaxInt32 >= len(l.SubSectors) {
+				return nil
+			}
+			return &l.SubSectors[child&math.MaxInt32]
+		}
+		if child >= len(l.Nodes) {
+			return nil
+		}
+		n := &l.Nodes[child]
+		child = n.ChildNumR
+		if l.pointOnSide(n, x, y) == 1 {
+			child = n.ChildNumL
+		}
+	}
+	if child < 0 && child&math.MaxInt32 < len(l.SubSectors) {
+		return &l.SubSectors[child&math.MaxInt32]
+	}
+	return nil
+}
+
+// SectorAt returns the sector containing a point, which is the sector of the subsector containing
+// it. As in Doom, points outside the map still find a sector.
+func (l *Level) SectorAt(x, y float64) *Sector {
+	s := l.SubSectorAt(x, y)
+	if s == nil {
+		return nil
+	}
+	return s.Sector
+}
+
+// pointOnSide returns the side of a node a point is on, using the level's arithmetic
+func (l *Level) pointOnSide(n *Node, x, y float64) int {
+	if l.FixedPoint {
+		return n.PointOnSideFixed(x, y)
+	}
+	return n.PointOnSide(x, y)
+}
+
+// Frustum is the wedge of the map a view can see: the angles within FOV/2 of Angle, both in
+// radians counterclockwise from east
+type Frustum struct {
+	Angle float64
+	FOV   float64 // At least 2π sees in every direction
+}
+
+// sees reports whether any part of a bounding box is in the frustum seen from x, y
+func (f *Frustum) sees(x, y float64, b *BoundBox) bool {
+	if f == nil || f.FOV >= 2*math.Pi {
+		return true
+	}
+	if x >= b.Left && x <= b.Right && y >= b.Bottom && y <= b.Top {
+		return true
+	}
+
+	// Seen from outside, the box spans less than half a turn, so its corners' angles can be
+	// measured from the direction of its center without wrapping
+	center := math.Atan2((b.Bottom+b.Top)/2-y, (b.Left+b.Right)/2-x)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, c := range [4][2]float64{{b.Left, b.Bottom}, {b.Left, b.Top}, {b.Right, b.Bottom},
+		{b.Right, b.Top}} {
+		a := normalizeAngle(math.Atan2(c[1]-y, c[0]-x) - center)
+		low, high = min(low, a), max(high, a)
+	}
+
+	// The arcs overlap if either starts within the other
+	boxStart, boxLength := center+low, high-low
+	viewStart, viewLength := f.Angle-f.FOV/2, f.FOV
+	return positiveAngle(viewStart-boxStart) <= boxLength ||
+		positiveAngle(boxStart-viewStart) <= viewLength
+}
+
+// normalizeAngle returns an angle in the range -π to π
+func normalizeAngle(a float64) float64 {
+	return math.Remainder(a, 2*math.Pi)
+}
+
+// positiveAngle returns an angle in the range 0 to 2π
+func positiveAngle(a float64) float64 {
+	a = math.Mod(a, 2*math.Pi)
+	if a < 0 {
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+// WalkFrontToBack calls fn for each subsector in order from nearest to farthest as seen from x,
+// y, as Doom's R_RenderBSPNode visits them. Branches whose bounding boxes are outside frustum are
+// skipped, unless frustum is nil. As node bounding boxes bound segs, a skipped subsector may still
+// cover part of the view, but none of its segs are in it. The walk stops if fn returns false.
+func (l *Level) WalkFrontToBack(x, y float64, frustum *Frustum, fn func(*SubSector) bool) {
+	l.walk(x, y, frustum, false, fn)
+}
+
+// WalkBackToFront calls fn for each subsector in order from farthest to nearest as seen from x,
+// y, as a painter's algorithm needs, skipping branches as for WalkFrontToBack
+func (l *Level) WalkBackToFront(x, y float64, frustum *Frustum, fn func(*SubSector) bool) {
+	l.walk(x, y, frustum, true, fn)
+}
+
+// FrontToBack returns an iterator over the subsectors visited by WalkFrontToBack
+func (l *Level) FrontToBack(x, y float64, frustum *Frustum) iter.Seq[*SubSector] {
+	return func(yield func(*SubSector) bool) {
+		l.WalkFrontToBack(x, y, frustum, yield)
+	}
+}
+
+// BackToFront returns an iterator over the subsectors visited by WalkBackToFront
+func (l *Level) BackToFront(x, y float64, frustum *Frustum) iter.Seq[*SubSector] {
+	return func(yield func(*SubSector) bool) {
+		l.WalkBackToFront(x, y, frustum, yield)
+	}
+}
+
+// walk visits the tree's subsectors, from the side of each node the point is on first unless
+// reversed
+func (l *Level) walk(x, y float64, frustum *Frustum, reversed bool, fn func(*SubSector) bool) {
+	if len(l.Nodes) == 0 {
+		if len(l.SubSectors) > 0 {
+			fn(&l.SubSectors[0])
+		}
+		return
+	}
+
+	var visit func(member BSPMember, depth int) bool
+	visit = func(member BSPMember, depth int) bool {
+		switch m := member.(type) {
+		case *SubSector:
+			return fn(m)
+		case *Node:
+			if m == nil || depth > len(l.Nodes) { // Guards against broken trees with cycles
+				return true
+			}
+			near := l.pointOnSide(m, x, y)
+			sides := [2]int{near, near ^ 1}
+			if reversed {
+				sides[0], sides[1] = sides[1], sides[0]
+			}
+			for _, side := range sides {
+				if frustum.sees(x, y, m.BoundBox(side)) && !visit(m.Child(side), depth+1) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	visit(&l.Nodes[len(l.Nodes)-1], 0)
+}
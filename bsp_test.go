@@ -0,0 +1,79 @@
+package wad
+
+import "testing"
+
+func TestPointOnSide(t *testing.T) {
+	tests := []struct {
+		name         string
+		node         Node
+		x, y         float64
+		float, fixed int // Sides from PointOnSide and from vanilla R_PointOnSide
+	}{
+		{"VerticalLeft", Node{DY: 64}, -1, 5, 1, 1},
+		{"VerticalRight", Node{DY: 64}, 1, 5, 0, 0},
+		{"VerticalOn", Node{DY: 64}, 0, 5, 1, 1},
+		{"HorizontalBelow", Node{DX: 64}, 5, -1, 0, 0},
+		{"HorizontalAbove", Node{DX: 64}, 5, 1, 1, 1},
+		{"HorizontalOn", Node{DX: 64}, 5, 0, 0, 0},
+		{"SignsRight", Node{DX: 64, DY: 64}, 10, -10, 0, 0},
+		{"SignsLeft", Node{DX: 64, DY: 64}, -10, 10, 1, 1},
+		{"DiagonalOn", Node{DX: 64, DY: 64}, 10, 10, 1, 1},
+		{"ReversedDiagonal", Node{X: 8, Y: 8, DX: -64, DY: -64}, 20, 10, 1, 1},
+
+		// The direction is truncated to 1, 1, putting the point right of the line
+		{"TruncatedDirection", Node{DX: 1.5, DY: 1}, 3, 2.5, 1, 0},
+
+		// The point rounds onto the line, which is the back
+		{"RoundedOntoLine", Node{DX: 64, DY: 64}, 10 + 1e-7, 10, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if side := tt.node.PointOnSide(tt.x, tt.y); side != tt.float {
+				t.Errorf("PointOnSide(%v, %v) = %v, want %v", tt.x, tt.y, side, tt.float)
+			}
+			if side := tt.node.PointOnSideFixed(tt.x, tt.y); side != tt.fixed {
+				t.Errorf("PointOnSideFixed(%v, %v) = %v, want %v", tt.x, tt.y, side, tt.fixed)
+			}
+		})
+	}
+}
+
+func TestDivlineSide(t *testing.T) {
+	tests := []struct {
+		name           string
+		x, y           float64
+		x1, y1, dx, dy float64
+		float, fixed   int // Sides from divlineSide and from vanilla P_DivlineSide
+	}{
+		{"VerticalOn", 0, 7, 0, 0, 0, 64, 2, 2},
+		{"VerticalLeft", -1, 7, 0, 0, 0, 64, 1, 1},
+		{"VerticalRight", 1, 7, 0, 0, 0, 64, 0, 0},
+		{"HorizontalAbove", 6, 100, 0, 5, 64, 0, 1, 1},
+		{"HorizontalBelow", 6, 0, 0, 5, 64, 0, 0, 0},
+
+		// Vanilla compares x with the line's y, so a point far above the line is on it, and one on
+		// the line is not
+		{"HorizontalXEqualsY", 5, 100, 0, 5, 64, 0, 1, 2},
+		{"HorizontalOn", 0, 5, 0, 5, 64, 0, 2, 0},
+
+		{"DiagonalRight", 20, 10, 0, 0, 64, 64, 0, 0},
+		{"DiagonalLeft", 10, 20, 0, 0, 64, 64, 1, 1},
+		{"DiagonalOn", 10, 10, 0, 0, 64, 64, 2, 2},
+
+		// Offsets are truncated to whole units before multiplying
+		{"TruncatedOffset", 10.5, 10, 0, 0, 64, 64, 0, 2},
+		{"TruncatedDirection", 3, 2.5, 0, 0, 1.5, 1, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Level{}
+			if side := l.divlineSide(tt.x, tt.y, tt.x1, tt.y1, tt.dx, tt.dy); side != tt.float {
+				t.Errorf("divlineSide = %v, want %v", side, tt.float)
+			}
+			l.FixedPoint = true
+			if side := l.divlineSide(tt.x, tt.y, tt.x1, tt.y1, tt.dx, tt.dy); side != tt.fixed {
+				t.Errorf("fixed point divlineSide = %v, want %v", side, tt.fixed)
+			}
+		})
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"fmt"
-	"image"
-	"image/color"
 	"image/png"
 	"log"
 	"os"
@@ -28,6 +26,7 @@ func main() {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	defer w.Close()
 
 	for i, t := range w.TexturesList {
 		fmt.Println("Texture:", i, t.Name, t.Index)
@@ -50,6 +49,12 @@ func main() {
 		fmt.Println(k)
 	}
 
+	for n, s := range w.Scores {
+		if err := createMIDI(n, s); err != nil {
+			fmt.Println(err)
+		}
+	}
+
 	p := w.GetPictureOrNil("M_GDHIGH")
 	fmt.Println(p.Name, p.LeftOffset, p.TopOffset)
 
@@ -102,23 +107,7 @@ func main() {
 }
 
 func createPNGPic(n string, p *wad.Picture, w *wad.WAD) error {
-	upLeft := image.Point{0, 0}
-	lowRight := image.Point{int(p.Width), int(p.Height)}
-	img := image.NewRGBA(image.Rectangle{upLeft, lowRight})
-
-	palette := w.Palettes[0]
-	colormap := w.ColorMaps[0]
-
-	// Set color for each pixel.
-	for x := range p.Columns {
-		for y, b := range p.Columns[x] {
-			if colormap[b] != w.TransparentIndex {
-				c := palette[colormap[b]]
-				rgb := color.RGBA{c.Red, c.Green, c.Blue, 0xff}
-				img.SetRGBA(x, y, rgb)
-			}
-		}
-	}
+	img := p.ToImage(&w.Palettes[0], &w.ColorMaps[0])
 
 	// Encode as PNG.
 	f, err := os.Create(fmt.Sprintf("../out/%v.png", n))
@@ -127,25 +116,12 @@ func createPNGPic(n string, p *wad.Picture, w *wad.WAD) error {
 		return err
 	}
 	defer f.Close()
-	png.Encode(f, img)
-	return nil
+	return png.Encode(f, img)
 }
 
 // createPNGFlat
 func createPNGFlat(n string, flat *wad.Flat, w *wad.WAD) error {
-	upLeft := image.Point{0, 0}
-	lowRight := image.Point{wad.FlatWidth, wad.FlatHeight}
-	img := image.NewRGBA(image.Rectangle{upLeft, lowRight})
-
-	palette := w.Palettes[0]
-	colormap := w.ColorMaps[0]
-
-	// Set color for each pixel.
-	for i, b := range flat.Data {
-		c := palette[colormap[b]]
-		rgb := color.RGBA{c.Red, c.Green, c.Blue, 0xff}
-		img.SetRGBA(i%wad.FlatWidth, i/wad.FlatWidth, rgb)
-	}
+	img := flat.ToImage(&w.Palettes[0], &w.ColorMaps[0])
 
 	// Encode as PNG.
 	f, err := os.Create(fmt.Sprintf("../out/%v.png", n))
@@ -154,7 +130,5 @@ func createPNGFlat(n string, flat *wad.Flat, w *wad.WAD) error {
 		return err
 	}
 	defer f.Close()
-	png.Encode(f, img)
-	return nil
-
+	return png.Encode(f, img)
 }
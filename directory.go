@@ -0,0 +1,88 @@
+package wad
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Lumps returns a copy of the WAD directory, with the lumps of all archives in load order
+func (w *WAD) Lumps() []LumpInfo {
+	lumps := make([]LumpInfo, len(w.lumpInfos))
+	copy(lumps, w.lumpInfos)
+	return lumps
+}
+
+// LumpIndex returns the index of the named lump, or -1 if there is none. When several lumps share
+// a name, the last loaded wins.
+func (w *WAD) LumpIndex(name string) int {
+	if i, ok := w.lumpNums[strings.ToUpper(name)]; ok {
+		return i
+	}
+	return -1
+}
+
+// FindLumps returns the indexes of all lumps with the given name, in load order
+func (w *WAD) FindLumps(name string) []int {
+	name = strings.ToUpper(name)
+	var indexes []int
+	for i := range w.lumpInfos {
+		if w.lumpInfos[i].Name == name {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// ReadLumpBytes reads the data of the lump at index idx
+func (w *WAD) ReadLumpBytes(idx int) ([]byte, error) {
+	if idx < 0 || idx >= len(w.lumpInfos) {
+		return nil, fmt.Errorf("lump index %v out of range", idx)
+	}
+	return w.readLump(&w.lumpInfos[idx])
+}
+
+// OpenLump returns a reader over the data of the lump at index idx. Each reader has its own
+// offset, so any number may be open at once.
+func (w *WAD) OpenLump(idx int) (io.ReadSeeker, error) {
+	if idx < 0 || idx >= len(w.lumpInfos) {
+		return nil, fmt.Errorf("lump index %v out of range", idx)
+	}
+	return w.lumpReader(&w.lumpInfos[idx]), nil
+}
+
+// Namespaces with alternative marker names used by PWAD tools, keyed by their vanilla start marker
+var knownNamespaces = map[string]namespace{
+	"F_START": flatMarkers,
+	"S_START": spriteMarkers,
+	"P_START": {[]string{"P_START", "PP_START"}, []string{"P_END", "PP_END"}},
+}
+
+// lookupNamespace returns the namespace delimited by the start and end markers, including the
+// alternative marker names if the namespace is one of Doom's own.
+func lookupNamespace(start, end string) namespace {
+	start, end = strings.ToUpper(start), strings.ToUpper(end)
+	if ns, ok := knownNamespaces[start]; ok && end == ns.ends[0] {
+		return ns
+	}
+	return namespace{[]string{start}, []string{end}}
+}
+
+// NamespaceLumps returns the indexes of the lumps between start and end markers, such as
+// "F_START" and "F_END", merged across all archives in load order. Doom's own namespaces also
+// match the markers written by PWAD tools, such as FF_START and FF_END.
+func (w *WAD) NamespaceLumps(start, end string) []int {
+	return w.namespaceLumps(lookupNamespace(start, end))
+}
+
+// NamespaceLumpIndex returns the index of the named lump between start and end markers, or -1 if
+// there is none. This finds a lump such as a flat even when another lump shares its name.
+func (w *WAD) NamespaceLumpIndex(start, end, name string) int {
+	name = strings.ToUpper(name)
+	for _, i := range w.NamespaceLumps(start, end) {
+		if w.lumpInfos[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,295 @@
+package wad
+
+// Boom generalized line specials pack their behavior into bit fields. Each kind has its own range
+// of types, with the trigger in bits 0-2 and the speed in bits 3-4.
+const (
+	genCrusherBase LineType = 0x2f80
+	genStairsBase  LineType = 0x3000
+	genLiftBase    LineType = 0x3400
+	genLockedBase  LineType = 0x3800
+	genDoorBase    LineType = 0x3c00
+	genCeilingBase LineType = 0x4000
+	genFloorBase   LineType = 0x6000
+	genEnd         LineType = 0x8000
+)
+
+// Direction is the way a generalized floor, ceiling or staircase moves
+type Direction int
+
+const (
+	DirectionDown Direction = iota
+	DirectionUp
+)
+
+// ChangeModel is the sector a generalized floor or ceiling copies its texture and type from
+type ChangeModel int
+
+const (
+	ModelTrigger ChangeModel = iota // The sector in front of the activating line
+	ModelNumeric                    // The adjacent sector whose height is the target
+)
+
+// Lock is the key a generalized locked door needs
+type Lock int
+
+const (
+	LockAnyKey Lock = iota
+	LockRedCard
+	LockBlueCard
+	LockYellowCard
+	LockRedSkull
+	LockBlueSkull
+	LockYellowSkull
+	LockAllKeys
+)
+
+// GeneralizedFloor is a decoded Boom generalized floor special
+type GeneralizedFloor struct {
+	Trigger    Trigger
+	Repeatable bool
+	Speed      Speed
+	Monsters   bool        // Monsters can activate it. Only possible when Change is ChangeNone.
+	Model      ChangeModel // Only meaningful when Change is not ChangeNone
+	Direction  Direction
+	Target     Target
+	Amount     int // The distance moved, for TargetCurrent
+	Change     Change
+	Crush      bool
+}
+
+// GeneralizedCeiling is a decoded Boom generalized ceiling special. Its fields are those of
+// GeneralizedFloor, with the ceiling moving instead.
+type GeneralizedCeiling GeneralizedFloor
+
+// GeneralizedDoor is a decoded Boom generalized door special
+type GeneralizedDoor struct {
+	Trigger    Trigger
+	Repeatable bool
+	Speed      Speed
+	Kind       DoorKind
+	Monsters   bool
+	Delay      int // Seconds waited before closing or opening again
+}
+
+// GeneralizedLockedDoor is a decoded Boom generalized locked door special
+type GeneralizedLockedDoor struct {
+	Trigger     Trigger
+	Repeatable  bool
+	Speed       Speed
+	Kind        DoorKind // DoorOpenWaitClose or DoorOpenStay
+	Lock        Lock
+	SkullIsCard bool // A skull key opens a card lock of the same color, and vice versa
+}
+
+// GeneralizedLift is a decoded Boom generalized lift special
+type GeneralizedLift struct {
+	Trigger    Trigger
+	Repeatable bool
+	Speed      Speed
+	Monsters   bool
+	Delay      int // Seconds waited before returning
+	Target     Target
+	Perpetual  bool // Moves between the lowest and highest adjacent floors until stopped
+}
+
+// GeneralizedStairs is a decoded Boom generalized stair building special
+type GeneralizedStairs struct {
+	Trigger       Trigger
+	Repeatable    bool
+	Speed         Speed
+	Monsters      bool
+	StepHeight    int
+	Direction     Direction
+	IgnoreTexture bool // Build steps across sectors with different floor textures
+}
+
+// GeneralizedCrusher is a decoded Boom generalized crusher special
+type GeneralizedCrusher struct {
+	Trigger    Trigger
+	Repeatable bool
+	Speed      Speed
+	Monsters   bool
+	Silent     bool
+}
+
+// IsGeneralized reports whether the type is in the range of Boom generalized specials
+func (t LineType) IsGeneralized() bool {
+	return t >= genCrusherBase && t < genEnd
+}
+
+// genTrigger decodes the trigger and speed fields common to all generalized specials
+func (t LineType) genTrigger() (Trigger, bool, Speed) {
+	triggers := [...]Trigger{TriggerWalk, TriggerSwitch, TriggerGun, TriggerDoor}
+	return triggers[t&7>>1], t&1 != 0, SpeedSlow + Speed(t>>3&3)
+}
+
+// GeneralizedFloor decodes a generalized floor special, or returns false if the type is not one
+func (t LineType) GeneralizedFloor() (GeneralizedFloor, bool) {
+	if t < genFloorBase || t >= genEnd {
+		return GeneralizedFloor{}, false
+	}
+	targets := [...]Target{
+		TargetHighestAdjacentFloor, TargetLowestAdjacentFloor, TargetNextHigherFloor,
+		TargetLowestAdjacentCeiling, TargetCeiling, TargetShortestLowerTexture, TargetCurrent,
+		TargetCurrent,
+	}
+	g := t.genPlane(targets)
+	if g.Target == TargetNextHigherFloor && g.Direction == DirectionDown {
+		g.Target = TargetNextLowerFloor
+	}
+	return g, true
+}
+
+// GeneralizedCeiling decodes a generalized ceiling special, or returns false if the type is not
+// one
+func (t LineType) GeneralizedCeiling() (GeneralizedCeiling, bool) {
+	if t < genCeilingBase || t >= genFloorBase {
+		return GeneralizedCeiling{}, false
+	}
+	targets := [...]Target{
+		TargetHighestAdjacentCeiling, TargetLowestAdjacentCeiling, TargetNextHigherCeiling,
+		TargetHighestAdjacentFloor, TargetFloor, TargetShortestUpperTexture, TargetCurrent,
+		TargetCurrent,
+	}
+	g := t.genPlane(targets)
+	if g.Target == TargetNextHigherCeiling && g.Direction == DirectionDown {
+		g.Target = TargetNextLowerCeiling
+	}
+	return GeneralizedCeiling(g), true
+}
+
+// genPlane decodes the fields shared by generalized floors and ceilings
+func (t LineType) genPlane(targets [8]Target) GeneralizedFloor {
+	var g GeneralizedFloor
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Change = ChangeNone + Change(t>>10&3)
+	if g.Change == ChangeNone {
+		g.Monsters = t&0x20 != 0
+	} else {
+		g.Model = ChangeModel(t >> 5 & 1)
+	}
+	g.Direction = Direction(t >> 6 & 1)
+	g.Target = targets[t>>7&7]
+	switch t >> 7 & 7 {
+	case 6:
+		g.Amount = 24
+	case 7:
+		g.Amount = 32
+	}
+	g.Crush = t&0x1000 != 0
+	return g
+}
+
+// GeneralizedDoor decodes a generalized door special, or returns false if the type is not one
+func (t LineType) GeneralizedDoor() (GeneralizedDoor, bool) {
+	if t < genDoorBase || t >= genCeilingBase {
+		return GeneralizedDoor{}, false
+	}
+	kinds := [...]DoorKind{DoorOpenWaitClose, DoorOpenStay, DoorCloseWaitOpen, DoorClose}
+	delays := [...]int{1, 4, 9, 30}
+	var g GeneralizedDoor
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Kind = kinds[t>>5&3]
+	g.Monsters = t&0x80 != 0
+	g.Delay = delays[t>>8&3]
+	return g, true
+}
+
+// GeneralizedLockedDoor decodes a generalized locked door special, or returns false if the type
+// is not one
+func (t LineType) GeneralizedLockedDoor() (GeneralizedLockedDoor, bool) {
+	if t < genLockedBase || t >= genDoorBase {
+		return GeneralizedLockedDoor{}, false
+	}
+	var g GeneralizedLockedDoor
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Kind = DoorOpenWaitClose
+	if t&0x20 != 0 {
+		g.Kind = DoorOpenStay
+	}
+	g.Lock = Lock(t >> 6 & 7)
+	g.SkullIsCard = t&0x200 != 0
+	return g, true
+}
+
+// GeneralizedLift decodes a generalized lift special, or returns false if the type is not one
+func (t LineType) GeneralizedLift() (GeneralizedLift, bool) {
+	if t < genLiftBase || t >= genLockedBase {
+		return GeneralizedLift{}, false
+	}
+	targets := [...]Target{
+		TargetLowestAdjacentFloor, TargetNextLowerFloor, TargetLowestAdjacentCeiling,
+		TargetLowestAdjacentFloor,
+	}
+	delays := [...]int{1, 3, 5, 10}
+	var g GeneralizedLift
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Monsters = t&0x20 != 0
+	g.Delay = delays[t>>6&3]
+	g.Target = targets[t>>8&3]
+	g.Perpetual = t>>8&3 == 3
+	return g, true
+}
+
+// GeneralizedStairs decodes a generalized stair building special, or returns false if the type is
+// not one
+func (t LineType) GeneralizedStairs() (GeneralizedStairs, bool) {
+	if t < genStairsBase || t >= genLiftBase {
+		return GeneralizedStairs{}, false
+	}
+	steps := [...]int{4, 8, 16, 24}
+	var g GeneralizedStairs
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Monsters = t&0x20 != 0
+	g.StepHeight = steps[t>>6&3]
+	g.Direction = Direction(t >> 8 & 1)
+	g.IgnoreTexture = t&0x200 != 0
+	return g, true
+}
+
+// GeneralizedCrusher decodes a generalized crusher special, or returns false if the type is not
+// one
+func (t LineType) GeneralizedCrusher() (GeneralizedCrusher, bool) {
+	if t < genCrusherBase || t >= genStairsBase {
+		return GeneralizedCrusher{}, false
+	}
+	var g GeneralizedCrusher
+	g.Trigger, g.Repeatable, g.Speed = t.genTrigger()
+	g.Monsters = t&0x20 != 0
+	g.Silent = t&0x40 != 0
+	return g, true
+}
+
+// Boom sector type bits. The low bits hold the lighting special, as in vanilla.
+const (
+	sectorSpecialMask  SectorType = 0x1f
+	sectorDamageMask   SectorType = 0x60
+	sectorSecretFlag   SectorType = 0x80
+	sectorFrictionFlag SectorType = 0x100
+	sectorWindFlag     SectorType = 0x200
+)
+
+// Special returns the lighting special of a Boom sector type, without its flag bits
+func (t SectorType) Special() SectorType {
+	return t & sectorSpecialMask
+}
+
+// Damage returns the damage per second dealt by a Boom sector type's damage bits: 0, 5, 10 or 20
+func (t SectorType) Damage() int {
+	return [...]int{0, 5, 10, 20}[(t&sectorDamageMask)>>5]
+}
+
+// Secret reports whether a Boom sector type's secret bit is set
+func (t SectorType) Secret() bool {
+	return t&sectorSecretFlag != 0
+}
+
+// Friction reports whether a Boom sector type's friction bit is set, enabling ice and mud lines
+func (t SectorType) Friction() bool {
+	return t&sectorFrictionFlag != 0
+}
+
+// Wind reports whether a Boom sector type's wind bit is set, enabling push and pull lines
+func (t SectorType) Wind() bool {
+	return t&sectorWindFlag != 0
+}
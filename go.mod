@@ -1,5 +1,5 @@
 module github.com/stuarthighley/wad
 
-go 1.22.1
+go 1.23
 
 require golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8
@@ -0,0 +1,66 @@
+package wad
+
+import (
+	"image"
+	"image/color"
+)
+
+// colorPalette converts a palette to a color.Palette, remapping each index through cmap when it
+// is not nil
+func colorPalette(pal *Palette, cmap *ColorMap) color.Palette {
+	palette := make(color.Palette, len(pal))
+	for i := range palette {
+		index := byte(i)
+		if cmap != nil {
+			index = cmap[i]
+		}
+		c := pal[index]
+		palette[i] = color.RGBA{c.Red, c.Green, c.Blue, 0xff}
+	}
+	return palette
+}
+
+// ToImage converts the picture to a paletted image using pal, with each pixel remapped through
+// cmap when it is not nil. Pixels not covered by any post are fully transparent.
+func (p *Picture) ToImage(pal *Palette, cmap *ColorMap) *image.Paletted {
+	palette := colorPalette(pal, cmap)
+	palette[p.TransparentIndex] = color.RGBA{}
+	img := image.NewPaletted(image.Rect(0, 0, p.Width, p.Height), palette)
+	for x, column := range p.Columns {
+		for y, b := range column {
+			img.Pix[y*img.Stride+x] = b
+		}
+	}
+	return img
+}
+
+// ToRGBA converts the picture to an RGBA image, as for ToImage
+func (p *Picture) ToRGBA(pal *Palette, cmap *ColorMap) *image.RGBA {
+	return toRGBA(p.ToImage(pal, cmap))
+}
+
+// ToImage converts the flat to a paletted image using pal, with each pixel remapped through cmap
+// when it is not nil
+func (f *Flat) ToImage(pal *Palette, cmap *ColorMap) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, FlatWidth, FlatHeight), colorPalette(pal, cmap))
+	copy(img.Pix, f.Data)
+	return img
+}
+
+// ToRGBA converts the flat to an RGBA image, as for ToImage
+func (f *Flat) ToRGBA(pal *Palette, cmap *ColorMap) *image.RGBA {
+	return toRGBA(f.ToImage(pal, cmap))
+}
+
+// toRGBA expands a paletted image
+func toRGBA(src *image.Paletted) *image.RGBA {
+	img := image.NewRGBA(src.Rect)
+	for i, index := range src.Pix {
+		r, g, b, a := src.Palette[index].RGBA()
+		img.Pix[4*i] = byte(r >> 8)
+		img.Pix[4*i+1] = byte(g >> 8)
+		img.Pix[4*i+2] = byte(b >> 8)
+		img.Pix[4*i+3] = byte(a >> 8)
+	}
+	return img
+}
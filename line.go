@@ -8,6 +8,14 @@ type binLine struct {
 	SideR, SideL           int16
 }
 
+type binHexenLine struct {
+	VertexStart, VertexEnd int16
+	Flags                  int16
+	Special                uint8
+	Args                   [5]uint8
+	SideR, SideL           int16
+}
+
 type Line struct {
 	V1Num                  int
 	V2Num                  int
@@ -24,6 +32,16 @@ type Line struct {
 	SectorTagNum           int
 	SideRNum, SideLNum     int
 
+	// Hexen format maps only. Type and SectorTagNum are zero, and the action is in Special.
+	Special    int
+	Args       [5]int
+	Repeatable bool
+	Activation Activation
+
+	Fields map[string]any // All fields of a UDMF map's linedef, keyed by lower case name
+
+	otherFlags int // Flag bits without a field, kept for writing the line back
+
 	// References
 	V1, V2                  Vertex
 	DX, DY                  float64 // Precalculated VertexEnd-VertexStart for side checking
@@ -36,6 +54,24 @@ type Line struct {
 	// SpecialData             Thinker   // Thinker for reversable actions	// Unused on Line? TODO
 }
 
+// validVertexes reports whether a line's vertex numbers are in range of the level's vertexes
+func (l *Level) validVertexes(line *Line) bool {
+	n := len(l.Vertexes)
+	return line.V1Num >= 0 && line.V1Num < n && line.V2Num >= 0 && line.V2Num < n
+}
+
+// Activation is how the special of a line in a Hexen format map is activated
+type Activation int
+
+const (
+	ActivationCross           Activation = iota // A player crosses the line
+	ActivationUse                               // A player uses the line
+	ActivationMonsterCross                      // A monster crosses the line
+	ActivationImpact                            // A projectile or hitscan attack hits the line
+	ActivationPush                              // A player bumps into the line
+	ActivationProjectileCross                   // A projectile crosses the line
+)
+
 type SlopeType int
 
 const (
@@ -45,149 +81,150 @@ const (
 	SlopeTypeNegative
 )
 
-// Type	Description
-// 1	DR Door
-// 2	W1 Door Stay Open
-// 3	W1 Door Close
-// 4	W1 Door
-// 5	W1 Floor To Lowest Adjacent Ceiling
-// 6	W1 Start Crusher, Fast Damage
-// 7	S1 Build Stairs 8 Up
-// 8	W1 Build Stairs 8 Up
-// 9	S1 Floor Donut
-// 10	W1 Lift Also Monsters
-// 11	S1 Exit (Normal)
-// 12	W1 Light To Highest Adjacent Level
-// 13	W1 Light To 255
-// 14	S1 Floor Up 32 Change Texture
-// 15	S1 Floor Up 24 Change Texture
-// 16	W1 Door Close and Open
-// 17	W1 Light Blink 1.0 Sec
-// 18	S1 Floor To Higher Adjacent Floor
-// 19	W1 Floor To Highest Adjacent Floor
-// 20	S1 Floor To Higher Floor Change Texture
-// 21	S1 Lift
-// 22	W1 Floor To Higher Floor Change Texture
-// 23	S1 Floor To Lowest Adjacent Floor
-// 24	G1 Floor To Lowest Adjacent Ceiling
-// 25	W1 Start Crusher, Slow Damage
-// 26	DR Door Blue Key
-// 27	DR Door Yellow Key
-// 28	DR Door Red Key
-// 29	S1 Door
-// 30	W1 Floor Up Shortest Lower Texture
-// 31	D1 Door Stay Open
-// 32	D1 Door Blue Key
-// 33	D1 Door Red Key
-// 34	D1 Door Yellow Key
-// 35	W1 Light To 35
-// 36	W1 Floor To 8 Above Highest Adjacent Floor Fast
-// 37	W1 Floor To Lowest Adjacent Floor Change Texture and Type
-// 38	W1 Floor To Lowest Adjacent Floor
-// 39	W1 Teleport
-// 40	W1 Ceiling To Highest Ceiling
-// 41	S1 Ceiling To Floor
-// 42	SR Door Close
-// 43	SR Ceiling To Floor
-// 44	W1 Ceiling To 8 Above Floor
-// 45	SR Floor To Highest Adjacent Floor
-// 46	GR Door Also Monsters
-// 47	G1 Floor To Higher Floor Change Texture
-// 48	Scrolling Wall Left
-// 49	S1 Start Crusher, Slow Damage
-// 50	S1 Door Close
-// 51	S1 Exit (Secret)
-// 52	W1 Exit (Normal)
-// 53	W1 Start Moving Floor
-// 54	W1 Stop Moving Floor
-// 55	S1 Floor To 8 Below Lowest Adjacent Ceiling and Crush
-// 56	W1 Floor To 8 Below Lowest Adjacent Ceiling and Crush
-// 57	W1 Stop Crusher
-// 58	W1 Floor Up 24
-// 59	W1 Floor Up 24 Change Texture and Type
-// 60	SR Floor To Lowest Adjacent Floor
-// 61	SR Door Stay Open
-// 62	SR Lift
-// 63	SR Door
-// 64	SR Floor To Lowest Adjacent Ceiling
-// 65	SR Floor To 8 Below Lowest Adjacent Ceiling and Crush
-// 66	SR Floor Up 24 Change Texture
-// 67	SR Floor Up 32 Change Texture
-// 68	SR Floor To Higher Floor Change Texture
-// 69	SR Floor To Higher Adjacent Floor
-// 70	SR Floor To 8 Above Higher Adjacent Floor Fast
-// 71	S1 Floor To 8 Above Higher Adjacent Floor Fast
-// 72	WR Ceiling To 8 Above Floor
-// 73	WR Start Crusher, Slow Damage
-// 74	WR Stop Crusher
-// 75	WR Door Close
-// 76	WR Door Close and Open
-// 77	WR Start Crusher, Fast Damage
-// 79	WR Light To 35
-// 80	WR Light To Highest Adjacent Level
-// 81	WR Light To 255
-// 82	WR Floor To Lowest Adjacent Floor
-// 83	WR Floor To Highest Adjacent Floor
-// 84	WR Floor To Lowest Adjacent Floor Change Texture and Type
-// 86	WR Door Stay Open
-// 87	WR Start Moving Floor
-// 88	WR Lift Also Monsters
-// 89	WR Stop Moving Floor
-// 90	WR Door
-// 91	WR Floor To Lowest Adjacent Ceiling
-// 92	WR Floor Up 24
-// 93	WR Floor Up 24 Change Texture and Type
-// 94	WR Floor To 8 Below Lowest Adjacent Ceiling and Crush
-// 95	WR Floor To Higher Floor Change Texture
-// 96	WR Floor Up Shortest Lower Texture
-// 97	WR Teleport
-// 98	WR Floor To 8 Above Highest Adjacent Floor Fast
-// 99	SR Door Blue Key Fast
-// 100	W1 Build Stairs 16 and Crush
-// 101	S1 Floor To Lowest Adjacent Ceiling
-// 102	S1 Floor To Highest Adjacent Floor
-// 103	S1 Door Stay Open
-// 104	W1 Light To Lowest Adjacent Level
-// 105	WR Door Fast
-// 106	WR Door Stay Open Fast
-// 107	WR Door Close Fast
-// 108	W1 Door Fast
-// 109	W1 Door Stay Open Fast
-// 110	W1 Door Close Fast
-// 111	S1 Door Fast
-// 112	S1 Door Stay Open Fast
-// 113	S1 Door Close Fast
-// 114	SR Door Fast
-// 115	SR Door Stay Open Fast
-// 116	SR Door Close Fast
-// 117	DR Door Fast
-// 118	D1 Door Fast
-// 119	W1 Floor To Higher Adjacent Floor
-// 120	WR Lift Fast
-// 121	W1 Lift Fast
-// 122	S1 Lift Fast
-// 123	SR Lift Fast
-// 124	W1 Exit (Secret)
-// 125	W1 Teleport Monsters Only
-// 126	WR Teleport Monsters Only
-// 127	S1 Build Stairs 16 + Crush
-// 128	WR Floor To Higher Adjacent Floor
-// 129	WR Floor To Higher Floor Fast
-// 130	W1 Floor To Higher Floor Fast
-// 131	S1 Floor To Higher Floor Fast
-// 132	SR Floor To Higher Floor Fast
-// 133	S1 Door Blue Key Fast
-// 134	SR Door Red Key Fast
-// 135	S1 Door Red Key Fast
-// 136	SR Door Yellow Key Fast
-// 137	S1 Door Yellow Key Fast
-// 138	SR Light To 255
-// 139	SR Light To 35
-// 140	S1 Floor Up 512
-// 141	W1 Start Crusher, Silent
-
+// LineType is a line special, which sets what happens when the line is crossed, used or shot.
+// The constants are the vanilla specials, named by trigger and action as in the Doom editing
+// references, and are described by Info.
 type LineType int
 
 const (
-// TODO
+	LineNone                                             LineType = 0
+	LineDRDoor                                           LineType = 1
+	LineW1DoorStayOpen                                   LineType = 2
+	LineW1DoorClose                                      LineType = 3
+	LineW1Door                                           LineType = 4
+	LineW1FloorToLowestAdjacentCeiling                   LineType = 5
+	LineW1StartCrusherFastDamage                         LineType = 6
+	LineS1BuildStairs8Up                                 LineType = 7
+	LineW1BuildStairs8Up                                 LineType = 8
+	LineS1FloorDonut                                     LineType = 9
+	LineW1LiftAlsoMonsters                               LineType = 10
+	LineS1ExitNormal                                     LineType = 11
+	LineW1LightToHighestAdjacentLevel                    LineType = 12
+	LineW1LightTo255                                     LineType = 13
+	LineS1FloorUp32ChangeTexture                         LineType = 14
+	LineS1FloorUp24ChangeTexture                         LineType = 15
+	LineW1DoorCloseAndOpen                               LineType = 16
+	LineW1LightBlink1Sec                                 LineType = 17
+	LineS1FloorToHigherAdjacentFloor                     LineType = 18
+	LineW1FloorToHighestAdjacentFloor                    LineType = 19
+	LineS1FloorToHigherFloorChangeTexture                LineType = 20
+	LineS1Lift                                           LineType = 21
+	LineW1FloorToHigherFloorChangeTexture                LineType = 22
+	LineS1FloorToLowestAdjacentFloor                     LineType = 23
+	LineG1FloorToLowestAdjacentCeiling                   LineType = 24
+	LineW1StartCrusherSlowDamage                         LineType = 25
+	LineDRDoorBlueKey                                    LineType = 26
+	LineDRDoorYellowKey                                  LineType = 27
+	LineDRDoorRedKey                                     LineType = 28
+	LineS1Door                                           LineType = 29
+	LineW1FloorUpShortestLowerTexture                    LineType = 30
+	LineD1DoorStayOpen                                   LineType = 31
+	LineD1DoorBlueKey                                    LineType = 32
+	LineD1DoorRedKey                                     LineType = 33
+	LineD1DoorYellowKey                                  LineType = 34
+	LineW1LightTo35                                      LineType = 35
+	LineW1FloorTo8AboveHighestAdjacentFloorFast          LineType = 36
+	LineW1FloorToLowestAdjacentFloorChangeTextureAndType LineType = 37
+	LineW1FloorToLowestAdjacentFloor                     LineType = 38
+	LineW1Teleport                                       LineType = 39
+	LineW1CeilingToHighestCeiling                        LineType = 40
+	LineS1CeilingToFloor                                 LineType = 41
+	LineSRDoorClose                                      LineType = 42
+	LineSRCeilingToFloor                                 LineType = 43
+	LineW1CeilingTo8AboveFloor                           LineType = 44
+	LineSRFloorToHighestAdjacentFloor                    LineType = 45
+	LineGRDoorAlsoMonsters                               LineType = 46
+	LineG1FloorToHigherFloorChangeTexture                LineType = 47
+	LineScrollingWallLeft                                LineType = 48
+	LineS1StartCrusherSlowDamage                         LineType = 49
+	LineS1DoorClose                                      LineType = 50
+	LineS1ExitSecret                                     LineType = 51
+	LineW1ExitNormal                                     LineType = 52
+	LineW1StartMovingFloor                               LineType = 53
+	LineW1StopMovingFloor                                LineType = 54
+	LineS1FloorTo8BelowLowestAdjacentCeilingAndCrush     LineType = 55
+	LineW1FloorTo8BelowLowestAdjacentCeilingAndCrush     LineType = 56
+	LineW1StopCrusher                                    LineType = 57
+	LineW1FloorUp24                                      LineType = 58
+	LineW1FloorUp24ChangeTextureAndType                  LineType = 59
+	LineSRFloorToLowestAdjacentFloor                     LineType = 60
+	LineSRDoorStayOpen                                   LineType = 61
+	LineSRLift                                           LineType = 62
+	LineSRDoor                                           LineType = 63
+	LineSRFloorToLowestAdjacentCeiling                   LineType = 64
+	LineSRFloorTo8BelowLowestAdjacentCeilingAndCrush     LineType = 65
+	LineSRFloorUp24ChangeTexture                         LineType = 66
+	LineSRFloorUp32ChangeTexture                         LineType = 67
+	LineSRFloorToHigherFloorChangeTexture                LineType = 68
+	LineSRFloorToHigherAdjacentFloor                     LineType = 69
+	LineSRFloorTo8AboveHigherAdjacentFloorFast           LineType = 70
+	LineS1FloorTo8AboveHigherAdjacentFloorFast           LineType = 71
+	LineWRCeilingTo8AboveFloor                           LineType = 72
+	LineWRStartCrusherSlowDamage                         LineType = 73
+	LineWRStopCrusher                                    LineType = 74
+	LineWRDoorClose                                      LineType = 75
+	LineWRDoorCloseAndOpen                               LineType = 76
+	LineWRStartCrusherFastDamage                         LineType = 77
+	LineWRLightTo35                                      LineType = 79
+	LineWRLightToHighestAdjacentLevel                    LineType = 80
+	LineWRLightTo255                                     LineType = 81
+	LineWRFloorToLowestAdjacentFloor                     LineType = 82
+	LineWRFloorToHighestAdjacentFloor                    LineType = 83
+	LineWRFloorToLowestAdjacentFloorChangeTextureAndType LineType = 84
+	LineWRDoorStayOpen                                   LineType = 86
+	LineWRStartMovingFloor                               LineType = 87
+	LineWRLiftAlsoMonsters                               LineType = 88
+	LineWRStopMovingFloor                                LineType = 89
+	LineWRDoor                                           LineType = 90
+	LineWRFloorToLowestAdjacentCeiling                   LineType = 91
+	LineWRFloorUp24                                      LineType = 92
+	LineWRFloorUp24ChangeTextureAndType                  LineType = 93
+	LineWRFloorTo8BelowLowestAdjacentCeilingAndCrush     LineType = 94
+	LineWRFloorToHigherFloorChangeTexture                LineType = 95
+	LineWRFloorUpShortestLowerTexture                    LineType = 96
+	LineWRTeleport                                       LineType = 97
+	LineWRFloorTo8AboveHighestAdjacentFloorFast          LineType = 98
+	LineSRDoorBlueKeyFast                                LineType = 99
+	LineW1BuildStairs16AndCrush                          LineType = 100
+	LineS1FloorToLowestAdjacentCeiling                   LineType = 101
+	LineS1FloorToHighestAdjacentFloor                    LineType = 102
+	LineS1DoorStayOpen                                   LineType = 103
+	LineW1LightToLowestAdjacentLevel                     LineType = 104
+	LineWRDoorFast                                       LineType = 105
+	LineWRDoorStayOpenFast                               LineType = 106
+	LineWRDoorCloseFast                                  LineType = 107
+	LineW1DoorFast                                       LineType = 108
+	LineW1DoorStayOpenFast                               LineType = 109
+	LineW1DoorCloseFast                                  LineType = 110
+	LineS1DoorFast                                       LineType = 111
+	LineS1DoorStayOpenFast                               LineType = 112
+	LineS1DoorCloseFast                                  LineType = 113
+	LineSRDoorFast                                       LineType = 114
+	LineSRDoorStayOpenFast                               LineType = 115
+	LineSRDoorCloseFast                                  LineType = 116
+	LineDRDoorFast                                       LineType = 117
+	LineD1DoorFast                                       LineType = 118
+	LineW1FloorToHigherAdjacentFloor                     LineType = 119
+	LineWRLiftFast                                       LineType = 120
+	LineW1LiftFast                                       LineType = 121
+	LineS1LiftFast                                       LineType = 122
+	LineSRLiftFast                                       LineType = 123
+	LineW1ExitSecret                                     LineType = 124
+	LineW1TeleportMonstersOnly                           LineType = 125
+	LineWRTeleportMonstersOnly                           LineType = 126
+	LineS1BuildStairs16AndCrush                          LineType = 127
+	LineWRFloorToHigherAdjacentFloor                     LineType = 128
+	LineWRFloorToHigherFloorFast                         LineType = 129
+	LineW1FloorToHigherFloorFast                         LineType = 130
+	LineS1FloorToHigherFloorFast                         LineType = 131
+	LineSRFloorToHigherFloorFast                         LineType = 132
+	LineS1DoorBlueKeyFast                                LineType = 133
+	LineSRDoorRedKeyFast                                 LineType = 134
+	LineS1DoorRedKeyFast                                 LineType = 135
+	LineSRDoorYellowKeyFast                              LineType = 136
+	LineS1DoorYellowKeyFast                              LineType = 137
+	LineSRLightTo255                                     LineType = 138
+	LineSRLightTo35                                      LineType = 139
+	LineS1FloorUp512                                     LineType = 140
+	LineW1StartCrusherSilent                             LineType = 141
 )
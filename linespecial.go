@@ -0,0 +1,756 @@
+package wad
+
+import "fmt"
+
+// Trigger is how a line special is activated
+type Trigger int
+
+const (
+	TriggerNone   Trigger = iota // Always active, such as a scrolling wall
+	TriggerWalk                  // W: crossing the line
+	TriggerSwitch                // S: using the line
+	TriggerGun                   // G: shooting the line
+	TriggerDoor                  // D, or P for push: using the line, which acts on the sector behind it
+)
+
+// String returns the trigger letter used in line special names
+func (t Trigger) String() string {
+	switch t {
+	case TriggerWalk:
+		return "W"
+	case TriggerSwitch:
+		return "S"
+	case TriggerGun:
+		return "G"
+	case TriggerDoor:
+		return "D"
+	}
+	return ""
+}
+
+// Key is the key a player needs to activate a line special
+type Key int
+
+const (
+	KeyNone Key = iota
+	KeyBlue
+	KeyYellow
+	KeyRed
+)
+
+// LineCategory is the kind of action a line special performs
+type LineCategory int
+
+const (
+	CategoryNone LineCategory = iota
+	CategoryDoor
+	CategoryFloor
+	CategoryCeiling
+	CategoryLift
+	CategoryCrusher
+	CategoryStairs
+	CategoryDonut
+	CategoryLight
+	CategoryExit
+	CategoryTeleport
+	CategoryScroll
+)
+
+// Target is the height or light level a line special moves its sectors to. Heights have the
+// special's Amount added.
+type Target int
+
+const (
+	TargetNone                   Target = iota
+	TargetCurrent                       // The moving plane's own height, so Amount is relative
+	TargetFloor                         // The sector's floor, for ceilings
+	TargetCeiling                       // The sector's ceiling, for floors
+	TargetLowestAdjacentFloor           // Including the sector's own floor
+	TargetHighestAdjacentFloor          // Excluding the sector's own floor
+	TargetNextHigherFloor               // The lowest adjacent floor above the sector's floor
+	TargetLowestAdjacentCeiling         // Excluding the sector's own ceiling
+	TargetHighestAdjacentCeiling        // Excluding the sector's own ceiling
+	TargetShortestLowerTexture          // The floor plus the shortest lower texture on its lines
+	TargetShortestUpperTexture          // The ceiling less the shortest upper texture on its lines
+	TargetNextLowerFloor                // The highest adjacent floor below the sector's floor
+	TargetNextHigherCeiling             // The lowest adjacent ceiling above the sector's ceiling
+	TargetNextLowerCeiling              // The highest adjacent ceiling below the sector's ceiling
+	TargetLevel                         // The light level Amount
+	TargetHighestAdjacentLight          // The brightest adjacent light level
+	TargetLowestAdjacentLight           // The darkest adjacent light level
+	TargetBlink                         // Blinks between the light level and the darkest adjacent
+)
+
+// Speed is how fast a line special moves, on Boom's scale for generalized specials. The speed in
+// units per tic depends on the category.
+type Speed int
+
+const (
+	SpeedNone Speed = iota // Instant
+	SpeedSlow
+	SpeedNormal
+	SpeedFast
+	SpeedTurbo
+)
+
+// Change is what a floor or ceiling special copies from another sector when it moves
+type Change int
+
+const (
+	ChangeNone            Change = iota
+	ChangeTextureZeroType        // The texture, and the sector type is cleared
+	ChangeTexture                // The texture
+	ChangeTextureAndType         // The texture and sector type
+)
+
+// DoorKind is how a door special moves
+type DoorKind int
+
+const (
+	DoorNone          DoorKind = iota
+	DoorOpenWaitClose          // Opens, waits 4 seconds and closes
+	DoorOpenStay               // Opens and stays open
+	DoorClose                  // Closes and stays closed
+	DoorCloseWaitOpen          // Closes, waits 30 seconds and opens
+)
+
+// LineTypeInfo describes what a line special does
+type LineTypeInfo struct {
+	Description  string
+	Trigger      Trigger
+	Repeatable   bool // Can be activated more than once
+	Key          Key
+	Monsters     bool // Monsters can activate it as well as players
+	MonstersOnly bool // Only monsters can activate it
+	Category     LineCategory
+	Target       Target
+	Amount       int // Added to the target height, or the light level for TargetLevel
+	Speed        Speed
+	Change       Change
+	Crush        bool     // Damages things caught by a moving floor or ceiling
+	Door         DoorKind // For CategoryDoor
+	Stop         bool     // Stops a crusher or moving floor instead of starting one
+	Secret       bool     // Exits to the secret level
+}
+
+// Info returns a description of a vanilla line special, or false if the type is not one
+func (t LineType) Info() (LineTypeInfo, bool) {
+	info, ok := lineTypeInfos[t]
+	return info, ok
+}
+
+// String returns the description of a vanilla line special, or its number
+func (t LineType) String() string {
+	if info, ok := lineTypeInfos[t]; ok {
+		return info.Description
+	}
+	return fmt.Sprintf("LineType(%d)", int(t))
+}
+
+// Vanilla line specials
+var lineTypeInfos = map[LineType]LineTypeInfo{
+	LineDRDoor: {
+		Description: "DR Door", Trigger: TriggerDoor, Repeatable: true, Monsters: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenWaitClose,
+	},
+	LineW1DoorStayOpen: {
+		Description: "W1 Door Stay Open", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineW1DoorClose: {
+		Description: "W1 Door Close", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetFloor, Speed: SpeedNormal, Door: DoorClose,
+	},
+	LineW1Door: {
+		Description: "W1 Door", Trigger: TriggerWalk, Monsters: true, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal,
+		Door: DoorOpenWaitClose,
+	},
+	LineW1FloorToLowestAdjacentCeiling: {
+		Description: "W1 Floor To Lowest Adjacent Ceiling", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Speed: SpeedSlow,
+	},
+	LineW1StartCrusherFastDamage: {
+		Description: "W1 Start Crusher, Fast Damage", Trigger: TriggerWalk,
+		Category: CategoryCrusher, Target: TargetFloor, Amount: 8, Speed: SpeedNormal, Crush: true,
+	},
+	LineS1BuildStairs8Up: {
+		Description: "S1 Build Stairs 8 Up", Trigger: TriggerSwitch, Category: CategoryStairs,
+		Target: TargetCurrent, Amount: 8, Speed: SpeedSlow,
+	},
+	LineW1BuildStairs8Up: {
+		Description: "W1 Build Stairs 8 Up", Trigger: TriggerWalk, Category: CategoryStairs,
+		Target: TargetCurrent, Amount: 8, Speed: SpeedSlow,
+	},
+	LineS1FloorDonut: {
+		Description: "S1 Floor Donut", Trigger: TriggerSwitch, Category: CategoryDonut,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedSlow, Change: ChangeTextureZeroType,
+	},
+	LineW1LiftAlsoMonsters: {
+		Description: "W1 Lift Also Monsters", Trigger: TriggerWalk, Monsters: true,
+		Category: CategoryLift, Target: TargetLowestAdjacentFloor, Speed: SpeedNormal,
+	},
+	LineS1ExitNormal: {
+		Description: "S1 Exit (Normal)", Trigger: TriggerSwitch, Category: CategoryExit,
+	},
+	LineW1LightToHighestAdjacentLevel: {
+		Description: "W1 Light To Highest Adjacent Level", Trigger: TriggerWalk,
+		Category: CategoryLight, Target: TargetHighestAdjacentLight,
+	},
+	LineW1LightTo255: {
+		Description: "W1 Light To 255", Trigger: TriggerWalk, Category: CategoryLight,
+		Target: TargetLevel, Amount: 255,
+	},
+	LineS1FloorUp32ChangeTexture: {
+		Description: "S1 Floor Up 32 Change Texture", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 32, Speed: SpeedSlow,
+		Change: ChangeTexture,
+	},
+	LineS1FloorUp24ChangeTexture: {
+		Description: "S1 Floor Up 24 Change Texture", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 24, Speed: SpeedSlow,
+		Change: ChangeTexture,
+	},
+	LineW1DoorCloseAndOpen: {
+		Description: "W1 Door Close and Open", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetFloor, Speed: SpeedNormal, Door: DoorCloseWaitOpen,
+	},
+	LineW1LightBlink1Sec: {
+		Description: "W1 Light Blink 1.0 Sec", Trigger: TriggerWalk, Category: CategoryLight,
+		Target: TargetBlink,
+	},
+	LineS1FloorToHigherAdjacentFloor: {
+		Description: "S1 Floor To Higher Adjacent Floor", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+	},
+	LineW1FloorToHighestAdjacentFloor: {
+		Description: "W1 Floor To Highest Adjacent Floor", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineS1FloorToHigherFloorChangeTexture: {
+		Description: "S1 Floor To Higher Floor Change Texture", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+		Change: ChangeTextureZeroType,
+	},
+	LineS1Lift: {
+		Description: "S1 Lift", Trigger: TriggerSwitch, Category: CategoryLift,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedNormal,
+	},
+	LineW1FloorToHigherFloorChangeTexture: {
+		Description: "W1 Floor To Higher Floor Change Texture", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+		Change: ChangeTextureZeroType,
+	},
+	LineS1FloorToLowestAdjacentFloor: {
+		Description: "S1 Floor To Lowest Adjacent Floor", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetLowestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineG1FloorToLowestAdjacentCeiling: {
+		Description: "G1 Floor To Lowest Adjacent Ceiling", Trigger: TriggerGun,
+		Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Speed: SpeedSlow,
+	},
+	LineW1StartCrusherSlowDamage: {
+		Description: "W1 Start Crusher, Slow Damage", Trigger: TriggerWalk,
+		Category: CategoryCrusher, Target: TargetFloor, Amount: 8, Speed: SpeedSlow, Crush: true,
+	},
+	LineDRDoorBlueKey: {
+		Description: "DR Door Blue Key", Trigger: TriggerDoor, Repeatable: true, Key: KeyBlue,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenWaitClose,
+	},
+	LineDRDoorYellowKey: {
+		Description: "DR Door Yellow Key", Trigger: TriggerDoor, Repeatable: true, Key: KeyYellow,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenWaitClose,
+	},
+	LineDRDoorRedKey: {
+		Description: "DR Door Red Key", Trigger: TriggerDoor, Repeatable: true, Key: KeyRed,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenWaitClose,
+	},
+	LineS1Door: {
+		Description: "S1 Door", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal,
+		Door: DoorOpenWaitClose,
+	},
+	LineW1FloorUpShortestLowerTexture: {
+		Description: "W1 Floor Up Shortest Lower Texture", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetShortestLowerTexture, Speed: SpeedSlow,
+	},
+	LineD1DoorStayOpen: {
+		Description: "D1 Door Stay Open", Trigger: TriggerDoor, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineD1DoorBlueKey: {
+		Description: "D1 Door Blue Key", Trigger: TriggerDoor, Key: KeyBlue, Monsters: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineD1DoorRedKey: {
+		Description: "D1 Door Red Key", Trigger: TriggerDoor, Key: KeyRed, Monsters: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineD1DoorYellowKey: {
+		Description: "D1 Door Yellow Key", Trigger: TriggerDoor, Key: KeyYellow, Monsters: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineW1LightTo35: {
+		Description: "W1 Light To 35", Trigger: TriggerWalk, Category: CategoryLight,
+		Target: TargetLevel, Amount: 35,
+	},
+	LineW1FloorTo8AboveHighestAdjacentFloorFast: {
+		Description: "W1 Floor To 8 Above Highest Adjacent Floor Fast", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Amount: 8, Speed: SpeedFast,
+	},
+	LineW1FloorToLowestAdjacentFloorChangeTextureAndType: {
+		Description: "W1 Floor To Lowest Adjacent Floor Change Texture and Type",
+		Trigger:     TriggerWalk, Category: CategoryFloor, Target: TargetLowestAdjacentFloor,
+		Speed: SpeedSlow, Change: ChangeTextureAndType,
+	},
+	LineW1FloorToLowestAdjacentFloor: {
+		Description: "W1 Floor To Lowest Adjacent Floor", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetLowestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineW1Teleport: {
+		Description: "W1 Teleport", Trigger: TriggerWalk, Monsters: true,
+		Category: CategoryTeleport,
+	},
+	LineW1CeilingToHighestCeiling: {
+		Description: "W1 Ceiling To Highest Ceiling", Trigger: TriggerWalk,
+		Category: CategoryCeiling, Target: TargetHighestAdjacentCeiling, Speed: SpeedSlow,
+	},
+	LineS1CeilingToFloor: {
+		Description: "S1 Ceiling To Floor", Trigger: TriggerSwitch, Category: CategoryCeiling,
+		Target: TargetFloor, Speed: SpeedSlow,
+	},
+	LineSRDoorClose: {
+		Description: "SR Door Close", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryDoor, Target: TargetFloor, Speed: SpeedNormal, Door: DoorClose,
+	},
+	LineSRCeilingToFloor: {
+		Description: "SR Ceiling To Floor", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryCeiling, Target: TargetFloor, Speed: SpeedSlow,
+	},
+	LineW1CeilingTo8AboveFloor: {
+		Description: "W1 Ceiling To 8 Above Floor", Trigger: TriggerWalk,
+		Category: CategoryCeiling, Target: TargetFloor, Amount: 8, Speed: SpeedSlow,
+	},
+	LineSRFloorToHighestAdjacentFloor: {
+		Description: "SR Floor To Highest Adjacent Floor", Trigger: TriggerSwitch,
+		Repeatable: true, Category: CategoryFloor, Target: TargetHighestAdjacentFloor,
+		Speed: SpeedSlow,
+	},
+	LineGRDoorAlsoMonsters: {
+		Description: "GR Door Also Monsters", Trigger: TriggerGun, Repeatable: true,
+		Monsters: true, Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineG1FloorToHigherFloorChangeTexture: {
+		Description: "G1 Floor To Higher Floor Change Texture", Trigger: TriggerGun,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+		Change: ChangeTextureZeroType,
+	},
+	LineScrollingWallLeft: {
+		Description: "Scrolling Wall Left", Trigger: TriggerNone, Category: CategoryScroll,
+	},
+	LineS1StartCrusherSlowDamage: {
+		Description: "S1 Start Crusher, Slow Damage", Trigger: TriggerSwitch,
+		Category: CategoryCrusher, Target: TargetFloor, Amount: 8, Speed: SpeedSlow, Crush: true,
+	},
+	LineS1DoorClose: {
+		Description: "S1 Door Close", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetFloor, Speed: SpeedNormal, Door: DoorClose,
+	},
+	LineS1ExitSecret: {
+		Description: "S1 Exit (Secret)", Trigger: TriggerSwitch, Category: CategoryExit,
+		Secret: true,
+	},
+	LineW1ExitNormal: {
+		Description: "W1 Exit (Normal)", Trigger: TriggerWalk, Category: CategoryExit,
+	},
+	LineW1StartMovingFloor: {
+		Description: "W1 Start Moving Floor", Trigger: TriggerWalk, Category: CategoryLift,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedNormal,
+	},
+	LineW1StopMovingFloor: {
+		Description: "W1 Stop Moving Floor", Trigger: TriggerWalk, Category: CategoryLift,
+		Stop: true,
+	},
+	LineS1FloorTo8BelowLowestAdjacentCeilingAndCrush: {
+		Description: "S1 Floor To 8 Below Lowest Adjacent Ceiling and Crush",
+		Trigger:     TriggerSwitch, Category: CategoryFloor, Target: TargetLowestAdjacentCeiling,
+		Amount: -8, Speed: SpeedSlow, Crush: true,
+	},
+	LineW1FloorTo8BelowLowestAdjacentCeilingAndCrush: {
+		Description: "W1 Floor To 8 Below Lowest Adjacent Ceiling and Crush", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Amount: -8, Speed: SpeedSlow,
+		Crush: true,
+	},
+	LineW1StopCrusher: {
+		Description: "W1 Stop Crusher", Trigger: TriggerWalk, Category: CategoryCrusher,
+		Stop: true,
+	},
+	LineW1FloorUp24: {
+		Description: "W1 Floor Up 24", Trigger: TriggerWalk, Category: CategoryFloor,
+		Target: TargetCurrent, Amount: 24, Speed: SpeedSlow,
+	},
+	LineW1FloorUp24ChangeTextureAndType: {
+		Description: "W1 Floor Up 24 Change Texture and Type", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 24, Speed: SpeedSlow,
+		Change: ChangeTextureAndType,
+	},
+	LineSRFloorToLowestAdjacentFloor: {
+		Description: "SR Floor To Lowest Adjacent Floor", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryFloor, Target: TargetLowestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineSRDoorStayOpen: {
+		Description: "SR Door Stay Open", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineSRLift: {
+		Description: "SR Lift", Trigger: TriggerSwitch, Repeatable: true, Category: CategoryLift,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedNormal,
+	},
+	LineSRDoor: {
+		Description: "SR Door", Trigger: TriggerSwitch, Repeatable: true, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal,
+		Door: DoorOpenWaitClose,
+	},
+	LineSRFloorToLowestAdjacentCeiling: {
+		Description: "SR Floor To Lowest Adjacent Ceiling", Trigger: TriggerSwitch,
+		Repeatable: true, Category: CategoryFloor, Target: TargetLowestAdjacentCeiling,
+		Speed: SpeedSlow,
+	},
+	LineSRFloorTo8BelowLowestAdjacentCeilingAndCrush: {
+		Description: "SR Floor To 8 Below Lowest Adjacent Ceiling and Crush",
+		Trigger:     TriggerSwitch, Repeatable: true, Category: CategoryFloor,
+		Target: TargetLowestAdjacentCeiling, Amount: -8, Speed: SpeedSlow, Crush: true,
+	},
+	LineSRFloorUp24ChangeTexture: {
+		Description: "SR Floor Up 24 Change Texture", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 32, Speed: SpeedSlow,
+		Change: ChangeTexture,
+	},
+	LineSRFloorUp32ChangeTexture: {
+		Description: "SR Floor Up 32 Change Texture", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 24, Speed: SpeedSlow,
+		Change: ChangeTexture,
+	},
+	LineSRFloorToHigherFloorChangeTexture: {
+		Description: "SR Floor To Higher Floor Change Texture", Trigger: TriggerSwitch,
+		Repeatable: true, Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+		Change: ChangeTextureZeroType,
+	},
+	LineSRFloorToHigherAdjacentFloor: {
+		Description: "SR Floor To Higher Adjacent Floor", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+	},
+	LineSRFloorTo8AboveHigherAdjacentFloorFast: {
+		Description: "SR Floor To 8 Above Higher Adjacent Floor Fast", Trigger: TriggerSwitch,
+		Repeatable: true, Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Amount: 8,
+		Speed: SpeedFast,
+	},
+	LineS1FloorTo8AboveHigherAdjacentFloorFast: {
+		Description: "S1 Floor To 8 Above Higher Adjacent Floor Fast", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Amount: 8, Speed: SpeedFast,
+	},
+	LineWRCeilingTo8AboveFloor: {
+		Description: "WR Ceiling To 8 Above Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryCeiling, Target: TargetFloor, Amount: 8, Speed: SpeedSlow,
+	},
+	LineWRStartCrusherSlowDamage: {
+		Description: "WR Start Crusher, Slow Damage", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryCrusher, Target: TargetFloor, Amount: 8, Speed: SpeedSlow, Crush: true,
+	},
+	LineWRStopCrusher: {
+		Description: "WR Stop Crusher", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryCrusher, Stop: true,
+	},
+	LineWRDoorClose: {
+		Description: "WR Door Close", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetFloor, Speed: SpeedNormal, Door: DoorClose,
+	},
+	LineWRDoorCloseAndOpen: {
+		Description: "WR Door Close and Open", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetFloor, Speed: SpeedNormal, Door: DoorCloseWaitOpen,
+	},
+	LineWRStartCrusherFastDamage: {
+		Description: "WR Start Crusher, Fast Damage", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryCrusher, Target: TargetFloor, Amount: 8, Speed: SpeedNormal, Crush: true,
+	},
+	LineWRLightTo35: {
+		Description: "WR Light To 35", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLight, Target: TargetLevel, Amount: 35,
+	},
+	LineWRLightToHighestAdjacentLevel: {
+		Description: "WR Light To Highest Adjacent Level", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLight, Target: TargetHighestAdjacentLight,
+	},
+	LineWRLightTo255: {
+		Description: "WR Light To 255", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLight, Target: TargetLevel, Amount: 255,
+	},
+	LineWRFloorToLowestAdjacentFloor: {
+		Description: "WR Floor To Lowest Adjacent Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetLowestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineWRFloorToHighestAdjacentFloor: {
+		Description: "WR Floor To Highest Adjacent Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineWRFloorToLowestAdjacentFloorChangeTextureAndType: {
+		Description: "WR Floor To Lowest Adjacent Floor Change Texture and Type",
+		Trigger:     TriggerWalk, Repeatable: true, Category: CategoryFloor,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedSlow, Change: ChangeTextureAndType,
+	},
+	LineWRDoorStayOpen: {
+		Description: "WR Door Stay Open", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineWRStartMovingFloor: {
+		Description: "WR Start Moving Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLift, Target: TargetLowestAdjacentFloor, Speed: SpeedNormal,
+	},
+	LineWRLiftAlsoMonsters: {
+		Description: "WR Lift Also Monsters", Trigger: TriggerWalk, Repeatable: true,
+		Monsters: true, Category: CategoryLift, Target: TargetLowestAdjacentFloor,
+		Speed: SpeedNormal,
+	},
+	LineWRStopMovingFloor: {
+		Description: "WR Stop Moving Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLift, Stop: true,
+	},
+	LineWRDoor: {
+		Description: "WR Door", Trigger: TriggerWalk, Repeatable: true, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal,
+		Door: DoorOpenWaitClose,
+	},
+	LineWRFloorToLowestAdjacentCeiling: {
+		Description: "WR Floor To Lowest Adjacent Ceiling", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Speed: SpeedSlow,
+	},
+	LineWRFloorUp24: {
+		Description: "WR Floor Up 24", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetCurrent, Amount: 24, Speed: SpeedSlow,
+	},
+	LineWRFloorUp24ChangeTextureAndType: {
+		Description: "WR Floor Up 24 Change Texture and Type", Trigger: TriggerWalk,
+		Repeatable: true, Category: CategoryFloor, Target: TargetCurrent, Amount: 24,
+		Speed: SpeedSlow, Change: ChangeTextureAndType,
+	},
+	LineWRFloorTo8BelowLowestAdjacentCeilingAndCrush: {
+		Description: "WR Floor To 8 Below Lowest Adjacent Ceiling and Crush", Trigger: TriggerWalk,
+		Repeatable: true, Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Amount: -8,
+		Speed: SpeedSlow, Crush: true,
+	},
+	LineWRFloorToHigherFloorChangeTexture: {
+		Description: "WR Floor To Higher Floor Change Texture", Trigger: TriggerWalk,
+		Repeatable: true, Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+		Change: ChangeTextureZeroType,
+	},
+	LineWRFloorUpShortestLowerTexture: {
+		Description: "WR Floor Up Shortest Lower Texture", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetShortestLowerTexture, Speed: SpeedSlow,
+	},
+	LineWRTeleport: {
+		Description: "WR Teleport", Trigger: TriggerWalk, Repeatable: true, Monsters: true,
+		Category: CategoryTeleport,
+	},
+	LineWRFloorTo8AboveHighestAdjacentFloorFast: {
+		Description: "WR Floor To 8 Above Highest Adjacent Floor Fast", Trigger: TriggerWalk,
+		Repeatable: true, Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Amount: 8,
+		Speed: SpeedFast,
+	},
+	LineSRDoorBlueKeyFast: {
+		Description: "SR Door Blue Key Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Key: KeyBlue, Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedTurbo, Door: DoorOpenStay,
+	},
+	LineW1BuildStairs16AndCrush: {
+		Description: "W1 Build Stairs 16 and Crush", Trigger: TriggerWalk,
+		Category: CategoryStairs, Target: TargetCurrent, Amount: 16, Speed: SpeedTurbo,
+		Crush: true,
+	},
+	LineS1FloorToLowestAdjacentCeiling: {
+		Description: "S1 Floor To Lowest Adjacent Ceiling", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetLowestAdjacentCeiling, Speed: SpeedSlow,
+	},
+	LineS1FloorToHighestAdjacentFloor: {
+		Description: "S1 Floor To Highest Adjacent Floor", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetHighestAdjacentFloor, Speed: SpeedSlow,
+	},
+	LineS1DoorStayOpen: {
+		Description: "S1 Door Stay Open", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedNormal, Door: DoorOpenStay,
+	},
+	LineW1LightToLowestAdjacentLevel: {
+		Description: "W1 Light To Lowest Adjacent Level", Trigger: TriggerWalk,
+		Category: CategoryLight, Target: TargetLowestAdjacentLight,
+	},
+	LineWRDoorFast: {
+		Description: "WR Door Fast", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenWaitClose,
+	},
+	LineWRDoorStayOpenFast: {
+		Description: "WR Door Stay Open Fast", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineWRDoorCloseFast: {
+		Description: "WR Door Close Fast", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryDoor, Target: TargetFloor, Speed: SpeedTurbo, Door: DoorClose,
+	},
+	LineW1DoorFast: {
+		Description: "W1 Door Fast", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenWaitClose,
+	},
+	LineW1DoorStayOpenFast: {
+		Description: "W1 Door Stay Open Fast", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo, Door: DoorOpenStay,
+	},
+	LineW1DoorCloseFast: {
+		Description: "W1 Door Close Fast", Trigger: TriggerWalk, Category: CategoryDoor,
+		Target: TargetFloor, Speed: SpeedTurbo, Door: DoorClose,
+	},
+	LineS1DoorFast: {
+		Description: "S1 Door Fast", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenWaitClose,
+	},
+	LineS1DoorStayOpenFast: {
+		Description: "S1 Door Stay Open Fast", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo, Door: DoorOpenStay,
+	},
+	LineS1DoorCloseFast: {
+		Description: "S1 Door Close Fast", Trigger: TriggerSwitch, Category: CategoryDoor,
+		Target: TargetFloor, Speed: SpeedTurbo, Door: DoorClose,
+	},
+	LineSRDoorFast: {
+		Description: "SR Door Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenWaitClose,
+	},
+	LineSRDoorStayOpenFast: {
+		Description: "SR Door Stay Open Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineSRDoorCloseFast: {
+		Description: "SR Door Close Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryDoor, Target: TargetFloor, Speed: SpeedTurbo, Door: DoorClose,
+	},
+	LineDRDoorFast: {
+		Description: "DR Door Fast", Trigger: TriggerDoor, Repeatable: true,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenWaitClose,
+	},
+	LineD1DoorFast: {
+		Description: "D1 Door Fast", Trigger: TriggerDoor, Category: CategoryDoor,
+		Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo, Door: DoorOpenStay,
+	},
+	LineW1FloorToHigherAdjacentFloor: {
+		Description: "W1 Floor To Higher Adjacent Floor", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+	},
+	LineWRLiftFast: {
+		Description: "WR Lift Fast", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryLift, Target: TargetLowestAdjacentFloor, Speed: SpeedFast,
+	},
+	LineW1LiftFast: {
+		Description: "W1 Lift Fast", Trigger: TriggerWalk, Category: CategoryLift,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedFast,
+	},
+	LineS1LiftFast: {
+		Description: "S1 Lift Fast", Trigger: TriggerSwitch, Category: CategoryLift,
+		Target: TargetLowestAdjacentFloor, Speed: SpeedFast,
+	},
+	LineSRLiftFast: {
+		Description: "SR Lift Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryLift, Target: TargetLowestAdjacentFloor, Speed: SpeedFast,
+	},
+	LineW1ExitSecret: {
+		Description: "W1 Exit (Secret)", Trigger: TriggerWalk, Category: CategoryExit,
+		Secret: true,
+	},
+	LineW1TeleportMonstersOnly: {
+		Description: "W1 Teleport Monsters Only", Trigger: TriggerWalk, Monsters: true,
+		MonstersOnly: true, Category: CategoryTeleport,
+	},
+	LineWRTeleportMonstersOnly: {
+		Description: "WR Teleport Monsters Only", Trigger: TriggerWalk, Repeatable: true,
+		Monsters: true, MonstersOnly: true, Category: CategoryTeleport,
+	},
+	LineS1BuildStairs16AndCrush: {
+		Description: "S1 Build Stairs 16 + Crush", Trigger: TriggerSwitch,
+		Category: CategoryStairs, Target: TargetCurrent, Amount: 16, Speed: SpeedTurbo,
+		Crush: true,
+	},
+	LineWRFloorToHigherAdjacentFloor: {
+		Description: "WR Floor To Higher Adjacent Floor", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedSlow,
+	},
+	LineWRFloorToHigherFloorFast: {
+		Description: "WR Floor To Higher Floor Fast", Trigger: TriggerWalk, Repeatable: true,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedFast,
+	},
+	LineW1FloorToHigherFloorFast: {
+		Description: "W1 Floor To Higher Floor Fast", Trigger: TriggerWalk,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedFast,
+	},
+	LineS1FloorToHigherFloorFast: {
+		Description: "S1 Floor To Higher Floor Fast", Trigger: TriggerSwitch,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedFast,
+	},
+	LineSRFloorToHigherFloorFast: {
+		Description: "SR Floor To Higher Floor Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryFloor, Target: TargetNextHigherFloor, Speed: SpeedFast,
+	},
+	LineS1DoorBlueKeyFast: {
+		Description: "S1 Door Blue Key Fast", Trigger: TriggerSwitch, Key: KeyBlue,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineSRDoorRedKeyFast: {
+		Description: "SR Door Red Key Fast", Trigger: TriggerSwitch, Repeatable: true, Key: KeyRed,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineS1DoorRedKeyFast: {
+		Description: "S1 Door Red Key Fast", Trigger: TriggerSwitch, Key: KeyRed,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineSRDoorYellowKeyFast: {
+		Description: "SR Door Yellow Key Fast", Trigger: TriggerSwitch, Repeatable: true,
+		Key: KeyYellow, Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4,
+		Speed: SpeedTurbo, Door: DoorOpenStay,
+	},
+	LineS1DoorYellowKeyFast: {
+		Description: "S1 Door Yellow Key Fast", Trigger: TriggerSwitch, Key: KeyYellow,
+		Category: CategoryDoor, Target: TargetLowestAdjacentCeiling, Amount: -4, Speed: SpeedTurbo,
+		Door: DoorOpenStay,
+	},
+	LineSRLightTo255: {
+		Description: "SR Light To 255", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryLight, Target: TargetLevel, Amount: 255,
+	},
+	LineSRLightTo35: {
+		Description: "SR Light To 35", Trigger: TriggerSwitch, Repeatable: true,
+		Category: CategoryLight, Target: TargetLevel, Amount: 35,
+	},
+	LineS1FloorUp512: {
+		Description: "S1 Floor Up 512", Trigger: TriggerSwitch, Category: CategoryFloor,
+		Target: TargetCurrent, Amount: 512, Speed: SpeedSlow,
+	},
+	LineW1StartCrusherSilent: {
+		Description: "W1 Start Crusher, Silent", Trigger: TriggerWalk, Category: CategoryCrusher,
+		Target: TargetFloor, Amount: 8, Speed: SpeedSlow, Crush: true,
+	},
+}
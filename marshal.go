@@ -0,0 +1,251 @@
+package wad
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// MarshalLumps serializes the level to the lumps that follow its header lump, in the order Doom
+// expects, for use with Writer.SetMap. Flags are packed back into the bit fields they were read
+// from, along with any bits that have no field, and items keep their indexes. A level read from a
+// Doom or Hexen format map with vanilla or uncompressed extended nodes is written back byte for
+// byte if nothing was changed, apart from any bytes after the zero that ends a texture name.
+// Compressed extended nodes are compressed again, so their bytes may differ. GL nodes are not
+// written; a level read with them writes back the vertexes and nodes of its map lumps instead.
+func (l *Level) MarshalLumps() ([]Lump, error) {
+	switch l.Format {
+	case MapFormatDoom, MapFormatHexen:
+	default:
+		return nil, errors.New("only Doom and Hexen format maps can be marshaled")
+	}
+	nodeLevel := l
+	if l.NodeFormat == NodesGL && l.mapNodes != nil {
+		nodeLevel = l.mapNodeLevel()
+	}
+	if nodeLevel.NodeFormat != NodesVanilla && nodeLevel.NodeFormat != NodesZDoom {
+		return nil, fmt.Errorf("marshaling node format %v is not supported", nodeLevel.NodeFormat)
+	}
+
+	lumps := map[string][]byte{}
+	nodeLumps, err := nodeLevel.EncodeNodes(nodeLevel.NodeFormat, l.nodesCompressed)
+	if err != nil {
+		return nil, err
+	}
+	for _, lump := range nodeLumps {
+		lumps[lump.Name] = lump.Data
+	}
+	if l.Format == MapFormatHexen {
+		lumps["THINGS"] = encode(l.hexenThingsToBin())
+		lumps["LINEDEFS"] = encode(l.hexenLinesToBin())
+		lumps["BEHAVIOR"] = l.Behavior
+		if lumps["BEHAVIOR"] == nil {
+			lumps["BEHAVIOR"] = []byte{}
+		}
+	} else {
+		lumps["THINGS"] = encode(l.thingsToBin())
+		lumps["LINEDEFS"] = encode(l.linesToBin())
+	}
+	lumps["SIDEDEFS"] = encode(l.sidesToBin())
+	lumps["SECTORS"] = encode(l.sectorsToBin())
+
+	// Reject and block map lumps are written as read if unchanged, as their layout varies
+	lumps["REJECT"] = l.rejectLump
+	if l.rejectLump == nil || !rejectEqual(decodeReject(l.rejectLump, len(l.Reject)), l.Reject) {
+		lumps["REJECT"] = l.EncodeReject().Data
+	}
+	lumps["BLOCKMAP"] = l.blockMapLump
+	if l.blockMapLump == nil || !l.blockMapUnchanged() {
+		lump, err := l.EncodeBlockMap()
+		if err != nil {
+			return nil, err
+		}
+		lumps["BLOCKMAP"] = lump.Data
+	}
+
+	var out []Lump
+	for _, name := range mapLumpNames {
+		if data, ok := lumps[name]; ok {
+			out = append(out, Lump{Name: name, Data: data})
+		}
+	}
+	return out, nil
+}
+
+// mapNodeLevel returns a copy of a level read with GL nodes that has the vertexes and nodes of its
+// map lumps instead
+func (l *Level) mapNodeLevel() *Level {
+	m := *l
+	m.NodeFormat = l.mapNodes.format
+	m.Vertexes = l.Vertexes[:l.mapNodes.numVertexes]
+	m.LineSegments = l.mapNodes.lineSegments
+	m.SubSectors = l.mapNodes.subSectors
+	m.Nodes = l.mapNodes.nodes
+	return &m
+}
+
+// thingsToBin packs the level's things in the Doom format
+func (l *Level) thingsToBin() []binThing {
+	bin := make([]binThing, len(l.Things))
+	for i, t := range l.Things {
+		options := t.otherFlags
+		for bit, set := range []bool{t.Skill1and2, t.Skill3, t.Skill4and5, t.Ambush,
+			t.MultiplayerOnly} {
+			if set {
+				options |= 1 << bit
+			}
+		}
+		bin[i] = binThing{
+			X:       int16(t.X),
+			Y:       int16(t.Y),
+			Angle:   radiansToDegrees(t.Angle),
+			Type:    int16(t.Type),
+			Options: int16(options),
+		}
+	}
+	return bin
+}
+
+// hexenThingsToBin packs the level's things in the Hexen format. MultiplayerOnly is ignored in
+// favor of SinglePlayer.
+func (l *Level) hexenThingsToBin() []binHexenThing {
+	bin := make([]binHexenThing, len(l.Things))
+	for i, t := range l.Things {
+		options := t.otherFlags
+		for bit, set := range []bool{t.Skill1and2, t.Skill3, t.Skill4and5, t.Ambush, t.Dormant,
+			t.Fighter, t.Cleric, t.Mage, t.SinglePlayer, t.Cooperative, t.Deathmatch} {
+			if set {
+				options |= 1 << bit
+			}
+		}
+		bin[i] = binHexenThing{
+			TID:     int16(t.TID),
+			X:       int16(t.X),
+			Y:       int16(t.Y),
+			Z:       int16(t.Z),
+			Angle:   radiansToDegrees(t.Angle),
+			Type:    int16(t.Type),
+			Options: int16(options),
+			Special: uint8(t.Special),
+		}
+		for j, arg := range t.Args {
+			bin[i].Args[j] = uint8(arg)
+		}
+	}
+	return bin
+}
+
+// lineFlags packs the flags common to Doom and Hexen format lines
+func (line *Line) lineFlags() int {
+	flags := line.otherFlags
+	for bit, set := range []bool{line.BlockPlayerAndMonsters, line.BlockMonsters, line.TwoSided,
+		line.UpperTextureUnpegged, line.LowerTextureUnpegged, line.Secret, line.BlocksSound,
+		line.NeverMap, line.Mapped} {
+		if set {
+			flags |= 1 << bit
+		}
+	}
+	return flags
+}
+
+// linesToBin packs the level's lines in the Doom format
+func (l *Level) linesToBin() []binLine {
+	bin := make([]binLine, len(l.Lines))
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		bin[i] = binLine{
+			VertexStart: int16(line.V1Num),
+			VertexEnd:   int16(line.V2Num),
+			Flags:       int16(line.lineFlags()),
+			Type:        int16(line.Type),
+			SectorTag:   int16(line.SectorTagNum),
+			SideR:       int16(line.SideRNum),
+			SideL:       int16(line.SideLNum),
+		}
+	}
+	return bin
+}
+
+// hexenLinesToBin packs the level's lines in the Hexen format
+func (l *Level) hexenLinesToBin() []binHexenLine {
+	bin := make([]binHexenLine, len(l.Lines))
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		flags := line.lineFlags() | int(line.Activation&7)<<10
+		if line.Repeatable {
+			flags |= 0x200
+		}
+		bin[i] = binHexenLine{
+			VertexStart: int16(line.V1Num),
+			VertexEnd:   int16(line.V2Num),
+			Flags:       int16(flags),
+			Special:     uint8(line.Special),
+			SideR:       int16(line.SideRNum),
+			SideL:       int16(line.SideLNum),
+		}
+		for j, arg := range line.Args {
+			bin[i].Args[j] = uint8(arg)
+		}
+	}
+	return bin
+}
+
+// sidesToBin packs the level's sides
+func (l *Level) sidesToBin() []binSide {
+	bin := make([]binSide, len(l.Sides))
+	for i, s := range l.Sides {
+		bin[i] = binSide{
+			XOffset:       int16(math.Round(s.XOffset)),
+			YOffset:       int16(math.Round(s.YOffset)),
+			UpperTexture:  newString8(s.UpperTextureName),
+			LowerTexture:  newString8(s.LowerTextureName),
+			MiddleTexture: newString8(s.MiddleTextureName),
+			SectorNum:     int16(s.SectorNum),
+		}
+	}
+	return bin
+}
+
+// sectorsToBin packs the level's sectors
+func (l *Level) sectorsToBin() []binSector {
+	bin := make([]binSector, len(l.Sectors))
+	for i, s := range l.Sectors {
+		bin[i] = binSector{
+			FloorHeight:    int16(math.Round(s.FloorHeight)),
+			CeilingHeight:  int16(math.Round(s.CeilingHeight)),
+			FloorTexture:   newString8(s.FloorTextureName),
+			CeilingTexture: newString8(s.CeilingTextureName),
+			LightLevel:     int16(s.LightLevel),
+			Type:           int16(s.Type),
+			TagNum:         int16(s.TagNum),
+		}
+	}
+	return bin
+}
+
+// blockMapUnchanged reports whether the block map matches the BLOCKMAP lump it was read from
+func (l *Level) blockMapUnchanged() bool {
+	read, err := decodeBlockMap(l.blockMapLump)
+	if err != nil || read.OriginX != l.BlockMap.OriginX || read.OriginY != l.BlockMap.OriginY ||
+		read.NumColumns != l.BlockMap.NumColumns || read.NumRows != l.BlockMap.NumRows ||
+		len(read.Blocks) != len(l.BlockMap.Blocks) {
+		return false
+	}
+	for i := range read.Blocks {
+		if !slices.Equal(read.Blocks[i].LineNums, l.BlockMap.Blocks[i].LineNums) {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectEqual reports whether two reject tables are the same
+func rejectEqual(a, b Reject) bool {
+	return slices.EqualFunc(a, b, slices.Equal)
+}
+
+// radiansToDegrees converts an angle to whole degrees, the inverse of degreesToRadians
+func radiansToDegrees(r float64) int16 {
+	return int16(math.Round(r * (180 / math.Pi)))
+}
@@ -0,0 +1,181 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// Two square sectors side by side, split by a two-sided line that is also the only partition
+var (
+	testVertexes = []binVertex{{0, 0}, {0, 64}, {64, 64}, {128, 64}, {128, 0}, {64, 0}}
+	testLines    = [][4]int16{ // V1, V2, right side, left side
+		{0, 1, 0, -1}, {1, 2, 1, -1}, {2, 3, 2, -1}, {3, 4, 3, -1}, {4, 5, 4, -1}, {5, 0, 5, -1},
+		{5, 2, 6, 7},
+	}
+	testSideSectors = []int16{0, 0, 1, 1, 1, 0, 1, 0}
+	testSegs        = []binLineSegment{
+		{0, 1, 0x4000, 0, 0, 0}, {1, 2, 0, 1, 0, 0}, {2, 5, 0xc000, 6, 1, 0}, {5, 0, 0x8000, 5, 0, 0},
+		{2, 3, 0, 2, 0, 0}, {3, 4, 0xc000, 3, 0, 0}, {4, 5, 0x8000, 4, 0, 0}, {5, 2, 0x4000, 6, 0, 0},
+	}
+	testSubSectors = []binSubSector{{4, 0}, {4, 4}}
+	testNodes      = []binNode{{X: 64, Y: 0, DX: 0, DY: 64,
+		BBoxR: binBBox{64, 0, 64, 128}, BBoxL: binBBox{64, 0, 0, 64},
+		ChildNumR: math.MinInt16 + 1, ChildNumL: math.MinInt16}}
+)
+
+// testMapLumps returns the lumps of the test map in the Doom or Hexen format
+func testMapLumps(format MapFormat) []Lump {
+	sides := make([]binSide, len(testSideSectors))
+	for i, sector := range testSideSectors {
+		sides[i] = binSide{XOffset: int16(i), UpperTexture: newString8("-"),
+			LowerTexture: newString8("-"), MiddleTexture: newString8("STARTAN3"), SectorNum: sector}
+	}
+	sides[6].MiddleTexture, sides[7].MiddleTexture = newString8("-"), newString8("-")
+	sectors := []binSector{
+		{0, 128, newString8("FLOOR4_8"), newString8("CEIL3_5"), 160, 0, 0},
+		{16, 96, newString8("FLOOR5_1"), newString8("F_SKY1"), 192, 9, 3},
+	}
+	blockMap := []int16{0, 0, 2, 1, 6, 15, 0, 0, 1, 2, 3, 4, 5, 6, -1, 0, 2, 3, 4, -1}
+
+	lumps := map[string][]byte{
+		"SIDEDEFS": encode(sides),
+		"VERTEXES": encode(testVertexes),
+		"SEGS":     encode(testSegs),
+		"SSECTORS": encode(testSubSectors),
+		"NODES":    encode(testNodes),
+		"SECTORS":  encode(sectors),
+		"REJECT":   {0},
+		"BLOCKMAP": encode(blockMap),
+	}
+	if format == MapFormatHexen {
+		things := []binHexenThing{
+			{0, 32, 32, 0, 90, 1, 0x07e7, 0, [5]uint8{}},
+			{5, 96, 32, 8, 180, 3001, 0x0106, 80, [5]uint8{1, 2, 3, 4, 5}},
+		}
+		lines := make([]binHexenLine, len(testLines))
+		for i, l := range testLines {
+			lines[i] = binHexenLine{VertexStart: l[0], VertexEnd: l[1], Flags: 1, SideR: l[2],
+				SideL: l[3]}
+		}
+		lines[6].Flags, lines[6].Special, lines[6].Args = 0x0404, 12, [5]uint8{3, 16, 0, 0, 0}
+		lumps["THINGS"] = encode(things)
+		lumps["LINEDEFS"] = encode(lines)
+		lumps["BEHAVIOR"] = []byte("ACS\x00\x08\x00\x00\x00\x00\x00\x00\x00")
+	} else {
+		things := []binThing{{32, 32, 90, 1, 7}, {96, 32, 180, 3001, 0x0fc}}
+		lines := make([]binLine, len(testLines))
+		for i, l := range testLines {
+			lines[i] = binLine{VertexStart: l[0], VertexEnd: l[1], Flags: 1, SideR: l[2],
+				SideL: l[3]}
+		}
+		lines[6].Flags, lines[6].Type, lines[6].SectorTag = 0x0204, 1, 3
+		lumps["THINGS"] = encode(things)
+		lumps["LINEDEFS"] = encode(lines)
+	}
+
+	var out []Lump
+	for _, name := range mapLumpNames {
+		if data, ok := lumps[name]; ok {
+			out = append(out, Lump{Name: name, Data: data})
+		}
+	}
+	return out
+}
+
+// testGLLumps returns GL nodes for the test map, with an unused GL vertex
+func testGLLumps() []Lump {
+	segs := make([]binGLSeg, len(testSegs))
+	for i, s := range testSegs {
+		segs[i] = binGLSeg{V1: uint16(s.V1), V2: uint16(s.V2), Line: uint16(s.LineNum),
+			Side: uint16(s.Direction), Partner: math.MaxUint16}
+	}
+	segs[2].Partner, segs[7].Partner = 7, 2
+	return []Lump{
+		{Name: "GL_VERT", Data: encode([]binVertex{{64, 32}})},
+		{Name: "GL_SEGS", Data: encode(segs)},
+		{Name: "GL_SSECT", Data: encode(testSubSectors)},
+		{Name: "GL_NODES", Data: encode(testNodes)},
+	}
+}
+
+// testWAD returns an IWAD with the lumps needed to open it and a map named MAP01
+func testWAD(t *testing.T, mapLumps, glLumps []Lump) *WAD {
+	t.Helper()
+	wr := NewWriter(ArchiveIWAD)
+	for _, l := range []Lump{
+		{Name: "PLAYPAL", Data: make([]byte, binary.Size(Palettes{}))},
+		{Name: "COLORMAP", Data: make([]byte, binary.Size(ColorMaps{}))},
+		{Name: "ENDOOM", Data: make([]byte, binary.Size(Endoom{}))},
+		{Name: "PNAMES", Data: make([]byte, 4)},
+		{Name: "S_START"}, {Name: "S_END"}, {Name: "F_START"}, {Name: "F_END"},
+	} {
+		if _, err := wr.Add(l.Name, l.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wr.SetMap("MAP01", mapLumps); err != nil {
+		t.Fatal(err)
+	}
+	if glLumps != nil {
+		if _, err := wr.Add("GL_MAP01", nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range glLumps {
+			if _, err := wr.Add(l.Name, l.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := wr.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWADFromBytesWithOptions(&Options{Lazy: true}, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestMarshalLumpsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     MapFormat
+		glLumps    []Lump
+		nodeFormat NodeFormat
+	}{
+		{"Doom", MapFormatDoom, nil, NodesVanilla},
+		{"Hexen", MapFormatHexen, nil, NodesVanilla},
+		{"DoomGL", MapFormatDoom, testGLLumps(), NodesGL},
+		{"HexenGL", MapFormatHexen, testGLLumps(), NodesGL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := testMapLumps(tt.format)
+			level, err := testWAD(t, want, tt.glLumps).ReadLevel("MAP01", struct{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level.Format != tt.format || level.NodeFormat != tt.nodeFormat {
+				t.Fatalf("read format %v with nodes %v, want %v with nodes %v", level.Format,
+					level.NodeFormat, tt.format, tt.nodeFormat)
+			}
+			got, err := level.MarshalLumps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %v lumps, want %v", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Name != want[i].Name || !bytes.Equal(got[i].Data, want[i].Data) {
+					t.Errorf("lump %v: got %v % x, want %v % x", i, got[i].Name, got[i].Data,
+						want[i].Name, want[i].Data)
+				}
+			}
+		})
+	}
+}
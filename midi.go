@@ -0,0 +1,139 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// MIDI constants used when converting MUS scores. Delays are kept at MUS's 140 ticks per second
+// by dividing each quarter note into 70 ticks at 120 beats per minute.
+const (
+	midiTicksPerQuarter   = MusTicksPerSecond / 2
+	midiTempo             = 500000 // Microseconds per quarter note
+	midiPercussionChannel = 9
+	musPercussionChannel  = 15
+)
+
+// MIDI controller numbers for MusController values
+var musToMIDIController = [...]byte{
+	MusInstrument:          0x00, // Sent as a program change instead
+	MusBankSelect:          0x20,
+	MusModulation:          0x01,
+	MusVolume:              0x07,
+	MusPan:                 0x0a,
+	MusExpression:          0x0b,
+	MusReverbDepth:         0x5b,
+	MusChorusDepth:         0x5d,
+	MusSustainPedal:        0x40,
+	MusSoftPedal:           0x43,
+	MusAllSoundsOff:        0x78,
+	MusAllNotesOff:         0x7b,
+	MusMono:                0x7e,
+	MusPoly:                0x7f,
+	MusResetAllControllers: 0x79,
+}
+
+// WriteMIDI converts the score to a type 0 Standard MIDI File. MUS channel 15 becomes the MIDI
+// percussion channel 9, and other MUS channels are given MIDI channels in order of first use,
+// skipping 9.
+func (s *MusicScore) WriteMIDI(w io.Writer) error {
+	var track bytes.Buffer
+	delta := 0
+
+	// writeEvent writes the pending delta time followed by the event bytes
+	writeEvent := func(data ...byte) {
+		writeVarLen(&track, delta)
+		delta = 0
+		track.Write(data)
+	}
+
+	// Set tempo
+	writeEvent(0xff, 0x51, 3, midiTempo>>16, midiTempo>>8&0xff, midiTempo&0xff)
+
+	// Map MUS channels to MIDI channels
+	var channelMap [16]int
+	for i := range channelMap {
+		channelMap[i] = -1
+	}
+	nextChannel := 0
+	midiChannel := func(musChannel int) byte {
+		if musChannel == musPercussionChannel {
+			return midiPercussionChannel
+		}
+		if channelMap[musChannel] < 0 {
+			if nextChannel == midiPercussionChannel {
+				nextChannel++
+			}
+			channelMap[musChannel] = nextChannel
+			nextChannel++
+
+			// Silence the channel on first use, as Chocolate Doom does
+			writeEvent(0xb0|byte(channelMap[musChannel]&0x0f), musToMIDIController[MusAllNotesOff], 0)
+		}
+		return byte(channelMap[musChannel] & 0x0f)
+	}
+
+	for _, e := range s.Events {
+		if e.EventType == ScoreEnd {
+			break
+		}
+		if e.EventType != Unknown1 {
+			channel := midiChannel(e.ChannelNum)
+			switch e.EventType {
+			case ReleaseNote:
+				writeEvent(0x80|channel, byte(e.Note), 0)
+			case PlayNote:
+				writeEvent(0x90|channel, byte(e.Note), byte(e.Velocity))
+			case PitchWheel:
+				bend := e.PitchBend * 64
+				writeEvent(0xe0|channel, byte(bend&0x7f), byte(bend>>7&0x7f))
+			case SystemEvent:
+				writeEvent(0xb0|channel, musToMIDIController[e.Controller], 0)
+			case ChangeController:
+				if e.Controller == MusInstrument {
+					writeEvent(0xc0|channel, byte(e.Value))
+				} else {
+					writeEvent(0xb0|channel, musToMIDIController[e.Controller], byte(e.Value))
+				}
+			}
+		}
+		delta += e.Delay
+	}
+
+	// End of track
+	writeEvent(0xff, 0x2f, 0)
+
+	// Write header chunk then track chunk
+	header := struct {
+		ID       [4]byte
+		Length   uint32
+		Format   uint16
+		Tracks   uint16
+		Division uint16
+	}{[4]byte{'M', 'T', 'h', 'd'}, 6, 0, 1, midiTicksPerQuarter}
+	if err := binary.Write(w, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	trackHeader := struct {
+		ID     [4]byte
+		Length uint32
+	}{[4]byte{'M', 'T', 'r', 'k'}, uint32(track.Len())}
+	if err := binary.Write(w, binary.BigEndian, &trackHeader); err != nil {
+		return err
+	}
+	_, err := w.Write(track.Bytes())
+	return err
+}
+
+// writeVarLen writes a MIDI variable length quantity, most significant 7 bits first
+func writeVarLen(b *bytes.Buffer, n int) {
+	var buf [5]byte
+	i := len(buf) - 1
+	buf[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		buf[i] = byte(n&0x7f) | 0x80
+	}
+	b.Write(buf[i:])
+}
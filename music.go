@@ -0,0 +1,165 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MusTicksPerSecond is the rate at which MUS event delays are counted
+const MusTicksPerSecond = 140
+
+var errScoreTruncated = errors.New("mus: score truncated")
+
+// DecodeMusic decodes a MUS format lump into a MusicScore, including its full event list
+func DecodeMusic(lump []byte) (*MusicScore, error) {
+
+	// Read header
+	reader := bytes.NewReader(lump)
+	var header binMusicHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, errors.New("mus: header truncated")
+	}
+	if string(header.ID[:]) != "MUS\x1a" {
+		return nil, fmt.Errorf("mus: bad magic: %q", header.ID)
+	}
+	if header.PrimaryCount > 15 || header.SecondaryCount > 6 {
+		return nil, fmt.Errorf("mus: bad channel counts %v, %v", header.PrimaryCount,
+			header.SecondaryCount)
+	}
+
+	// Read the instruments
+	instruments := make(binMusicInstruments, header.InstrumentCount)
+	if err := binary.Read(reader, binary.LittleEndian, instruments); err != nil {
+		return nil, errors.New("mus: instruments truncated")
+	}
+	score := &MusicScore{
+		PrimaryChannels:   int(header.PrimaryCount),
+		SecondaryChannels: int(header.SecondaryCount),
+		Instruments:       make([]int, len(instruments)),
+	}
+	for i, instrument := range instruments {
+		score.Instruments[i] = int(instrument)
+	}
+
+	// Ignore the score length, which some lumps understate, and read events up to ScoreEnd
+	start := int(header.ScoreStart)
+	if start > len(lump) {
+		return nil, errScoreTruncated
+	}
+	events, err := decodeMusicEvents(lump[start:])
+	if err != nil {
+		return nil, err
+	}
+	score.Events = events
+	return score, nil
+}
+
+// decodeMusicEvents decodes a MUS event stream up to and including the ScoreEnd event
+func decodeMusicEvents(data []byte) ([]SoundEvent, error) {
+	events := make([]SoundEvent, 0)
+	velocities := [16]int{}
+	for i := range velocities {
+		velocities[i] = 127
+	}
+	pos := 0
+	next := func() (int, error) {
+		if pos >= len(data) {
+			return 0, errScoreTruncated
+		}
+		pos++
+		return int(data[pos-1]), nil
+	}
+
+	for {
+		// Bits 0-3  Channel number
+		// Bits 4-6  Event type
+		// Bit 7     Last (if set, event is followed by time information)
+		b, err := next()
+		if err != nil {
+			return nil, err
+		}
+		event := SoundEvent{
+			ChannelNum: b & 0x0f,
+			EventType:  SoundEventType(b >> 4 & 7),
+			Last:       b&0x80 != 0,
+		}
+
+		switch event.EventType {
+		case ReleaseNote:
+			note, err := next()
+			if err != nil {
+				return nil, err
+			}
+			event.Note = note & 0x7f
+		case PlayNote:
+			note, err := next()
+			if err != nil {
+				return nil, err
+			}
+			event.Note = note & 0x7f
+			if note&0x80 != 0 {
+				velocity, err := next()
+				if err != nil {
+					return nil, err
+				}
+				velocities[event.ChannelNum] = velocity & 0x7f
+			}
+			event.Velocity = velocities[event.ChannelNum]
+		case PitchWheel:
+			if event.PitchBend, err = next(); err != nil {
+				return nil, err
+			}
+		case SystemEvent:
+			controller, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if controller < int(MusAllSoundsOff) || controller > int(MusResetAllControllers) {
+				return nil, fmt.Errorf("mus: bad system event %v", controller)
+			}
+			event.Controller = MusController(controller)
+		case ChangeController:
+			controller, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if controller > int(MusSoftPedal) {
+				return nil, fmt.Errorf("mus: bad controller %v", controller)
+			}
+			value, err := next()
+			if err != nil {
+				return nil, err
+			}
+			event.Controller = MusController(controller)
+			event.Value = min(value, 0x7f)
+		case Unknown1, ScoreEnd:
+			// No data
+		default:
+			return nil, fmt.Errorf("mus: bad event type %v at offset %v", event.EventType, pos-1)
+		}
+
+		// Read delay as a variable length quantity, most significant 7 bits first
+		if event.Last {
+			for {
+				b, err := next()
+				if err != nil {
+					return nil, err
+				}
+				event.Delay = event.Delay<<7 | b&0x7f
+				if b&0x80 == 0 {
+					break
+				}
+				if event.Delay > 1<<28 {
+					return nil, errors.New("mus: bad delay")
+				}
+			}
+		}
+
+		events = append(events, event)
+		if event.EventType == ScoreEnd {
+			return events, nil
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package wad
+
+import (
+	"errors"
+	"math"
+)
+
+// NodeBuilderOptions controls how BuildNodes picks partition lines
+type NodeBuilderOptions struct {
+	// SplitCost is the cost of splitting a seg in two, weighed against the difference between the
+	// number of segs on each side of a partition line. Zero means DefaultSplitCost.
+	SplitCost int
+
+	// MaxCandidates limits the number of lines tried as partition lines at each node, spread evenly
+	// through the segs. Zero tries every line, which is slow for large maps.
+	MaxCandidates int
+}
+
+// DefaultSplitCost is the cost of a seg split used when NodeBuilderOptions.SplitCost is zero
+const DefaultSplitCost = 8
+
+// Points closer than this to a partition line are on it
+const bspEpsilon = 1.0 / 1024
+
+// nodeBuilder holds the state of a BuildNodes run
+type nodeBuilder struct {
+	level      *Level
+	splitCost  int
+	candidates int
+	vertexes   []Vertex
+	vertexNums map[[2]float64]int
+	segs       []LineSegment
+	subSectors []SubSector
+	nodes      []Node
+}
+
+// BuildNodes builds the level's BSP tree from its lines, sides and vertexes, replacing its segs,
+// subsectors and nodes. Partition lines are picked to balance the number of segs on each side
+// while keeping seg splits few, and the vertexes created by splits are appended to the level's
+// vertexes. Vertexes added by the nodes being replaced, such as extended or GL node vertexes, are
+// removed first. Pointers are then set as by ReadLevel.
+func BuildNodes(level *Level, opts NodeBuilderOptions) error {
+	numVertexes := len(level.Vertexes)
+	if level.mapNodes != nil {
+		numVertexes = min(numVertexes, level.mapNodes.numVertexes)
+	}
+	if level.orgVertexes > 0 {
+		numVertexes = min(numVertexes, level.orgVertexes)
+	}
+	b := &nodeBuilder{
+		level:      level,
+		splitCost:  opts.SplitCost,
+		candidates: opts.MaxCandidates,
+		vertexes:   level.Vertexes[:numVertexes:numVertexes],
+		vertexNums: map[[2]float64]int{},
+	}
+	if b.splitCost == 0 {
+		b.splitCost = DefaultSplitCost
+	}
+	for i, v := range b.vertexes {
+		b.vertexNums[[2]float64{v.X, v.Y}] = i
+	}
+
+	// Start with a seg for each side of each line
+	var segs []LineSegment
+	for i, line := range level.Lines {
+		if !level.validVertexes(&line) || max(line.V1Num, line.V2Num) >= numVertexes {
+			return errors.New("line with bad vertex")
+		}
+		if line.V1Num == line.V2Num {
+			continue
+		}
+		if line.SideRNum >= 0 {
+			segs = append(segs, b.newSeg(line.V1Num, line.V2Num, i, false, 0))
+		}
+		if line.SideLNum >= 0 {
+			segs = append(segs, b.newSeg(line.V2Num, line.V1Num, i, true, 0))
+		}
+	}
+	if len(segs) == 0 {
+		return errors.New("no lines to build nodes from")
+	}
+
+	b.build(segs)
+	level.orgVertexes, level.mapNodes = numVertexes, nil
+	level.Vertexes = b.vertexes
+	level.LineSegments = b.segs
+	level.SubSectors = b.subSectors
+	level.Nodes = b.nodes
+	level.NodeFormat = NodesVanilla
+	level.setNodeReferences()
+	return nil
+}
+
+// newSeg creates a seg from v1 to v2 along a side of a line, offset from the start of the side
+func (b *nodeBuilder) newSeg(v1, v2, line int, isSideL bool, offset float64) LineSegment {
+	p1, p2 := b.vertexes[v1], b.vertexes[v2]
+	angle := math.Atan2(p2.Y-p1.Y, p2.X-p1.X)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	return LineSegment{V1Num: v1, V2Num: v2, Angle: angle, LineNum: line, IsSideL: isSideL,
+		Offset: offset, PartnerNum: -1}
+}
+
+// build builds the tree for a set of segs and returns the node or subsector at its top, as a node
+// child
+func (b *nodeBuilder) build(segs []LineSegment) int {
+	partition, ok := b.pickPartition(segs)
+	if !ok {
+		// Convex, so the segs make a subsector
+		b.subSectors = append(b.subSectors, SubSector{
+			numLineSegments:  len(segs),
+			StartLineSegment: len(b.segs),
+		})
+		b.segs = append(b.segs, segs...)
+		return (len(b.subSectors) - 1) | math.MinInt32
+	}
+
+	front, back := b.split(segs, partition)
+	node := Node{
+		X:     partition.X,
+		Y:     partition.Y,
+		DX:    partition.DX,
+		DY:    partition.DY,
+		BBoxR: b.bounds(front),
+		BBoxL: b.bounds(back),
+	}
+	node.ChildNumR = b.build(front)
+	node.ChildNumL = b.build(back)
+	b.nodes = append(b.nodes, node)
+	return len(b.nodes) - 1
+}
+
+// partitionLine is a candidate partition line, running along a side of a line
+type partitionLine struct {
+	X, Y, DX, DY float64
+}
+
+// along returns the partition line running along a seg. The seg's whole line is used, so that
+// partition lines keep to the map's own coordinates.
+func (b *nodeBuilder) along(seg *LineSegment) partitionLine {
+	line := &b.level.Lines[seg.LineNum]
+	v1, v2 := b.vertexes[line.V1Num], b.vertexes[line.V2Num]
+	if seg.IsSideL {
+		v1, v2 = v2, v1
+	}
+	return partitionLine{v1.X, v1.Y, v2.X - v1.X, v2.Y - v1.Y}
+}
+
+// side returns the signed distance of a vertex from a partition line, negative on the right
+func (p *partitionLine) side(v Vertex) float64 {
+	return (p.DX*(v.Y-p.Y) - p.DY*(v.X-p.X)) / math.Hypot(p.DX, p.DY)
+}
+
+// classify returns the sides of a partition line that a seg's vertexes are on: -1 on the right, 1
+// on the left, or 0 on the line
+func (b *nodeBuilder) classify(p *partitionLine, seg *LineSegment) (int, int, float64, float64) {
+	d1, d2 := p.side(b.vertexes[seg.V1Num]), p.side(b.vertexes[seg.V2Num])
+	sign := func(d float64) int {
+		switch {
+		case d < -bspEpsilon:
+			return -1
+		case d > bspEpsilon:
+			return 1
+		}
+		return 0
+	}
+	return sign(d1), sign(d2), d1, d2
+}
+
+// pickPartition returns the cheapest partition line that has segs on both sides, or false if the
+// segs are convex
+func (b *nodeBuilder) pickPartition(segs []LineSegment) (partitionLine, bool) {
+	var candidates []int
+	tried := map[int]bool{}
+	for i := range segs {
+		if !tried[segs[i].LineNum] {
+			tried[segs[i].LineNum] = true
+			candidates = append(candidates, i)
+		}
+	}
+	if b.candidates > 0 && len(candidates) > b.candidates {
+		spread := make([]int, b.candidates)
+		for i := range spread {
+			spread[i] = candidates[i*len(candidates)/b.candidates]
+		}
+		candidates = spread
+	}
+
+	var best partitionLine
+	bestCost, found := math.MaxInt, false
+	for _, c := range candidates {
+		p := b.along(&segs[c])
+		front, back, splits := 0, 0, 0
+		for i := range segs {
+			s1, s2, _, _ := b.classify(&p, &segs[i])
+			switch {
+			case s1 == 0 && s2 == 0:
+				// On the line, so on the side it faces
+				v1, v2 := b.vertexes[segs[i].V1Num], b.vertexes[segs[i].V2Num]
+				if (v2.X-v1.X)*p.DX+(v2.Y-v1.Y)*p.DY > 0 {
+					front++
+				} else {
+					back++
+				}
+			case s1 <= 0 && s2 <= 0:
+				front++
+			case s1 >= 0 && s2 >= 0:
+				back++
+			default:
+				splits++
+			}
+		}
+		if back+splits == 0 || front+splits == 0 {
+			continue
+		}
+		cost := splits*b.splitCost + abs(front-back)
+		if cost < bestCost {
+			best, bestCost, found = p, cost, true
+		}
+	}
+
+	// A candidate with all segs on one side may have been skipped by sampling, but segs that are
+	// not convex always have one with segs on both sides
+	if !found && b.candidates > 0 && len(segs) > b.candidates && !b.convex(segs) {
+		all := *b
+		all.candidates = 0
+		return all.pickPartition(segs)
+	}
+	return best, found
+}
+
+// convex reports whether no seg lies on the left of another
+func (b *nodeBuilder) convex(segs []LineSegment) bool {
+	for i := range segs {
+		p := partitionLine{
+			b.vertexes[segs[i].V1Num].X, b.vertexes[segs[i].V1Num].Y,
+			b.vertexes[segs[i].V2Num].X - b.vertexes[segs[i].V1Num].X,
+			b.vertexes[segs[i].V2Num].Y - b.vertexes[segs[i].V1Num].Y,
+		}
+		for j := range segs {
+			if s1, s2, _, _ := b.classify(&p, &segs[j]); s1 > 0 || s2 > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// split divides segs between the front and back of a partition line, splitting segs that cross it
+func (b *nodeBuilder) split(segs []LineSegment, p partitionLine) ([]LineSegment, []LineSegment) {
+	var front, back []LineSegment
+	for i := range segs {
+		seg := segs[i]
+		s1, s2, d1, d2 := b.classify(&p, &seg)
+		switch {
+		case s1 == 0 && s2 == 0:
+			v1, v2 := b.vertexes[seg.V1Num], b.vertexes[seg.V2Num]
+			if (v2.X-v1.X)*p.DX+(v2.Y-v1.Y)*p.DY > 0 {
+				front = append(front, seg)
+			} else {
+				back = append(back, seg)
+			}
+		case s1 <= 0 && s2 <= 0:
+			front = append(front, seg)
+		case s1 >= 0 && s2 >= 0:
+			back = append(back, seg)
+		default:
+			v1, v2 := b.vertexes[seg.V1Num], b.vertexes[seg.V2Num]
+			t := d1 / (d1 - d2)
+			mid := b.vertex(v1.X+t*(v2.X-v1.X), v1.Y+t*(v2.Y-v1.Y))
+			first := b.newSeg(seg.V1Num, mid, seg.LineNum, seg.IsSideL, seg.Offset)
+			second := b.newSeg(mid, seg.V2Num, seg.LineNum, seg.IsSideL,
+				seg.Offset+math.Hypot(b.vertexes[mid].X-v1.X, b.vertexes[mid].Y-v1.Y))
+			if s1 < 0 {
+				front, back = append(front, first), append(back, second)
+			} else {
+				front, back = append(front, second), append(back, first)
+			}
+		}
+	}
+	return front, back
+}
+
+// vertex returns the index of the vertex at x, y, adding it if it is new
+func (b *nodeBuilder) vertex(x, y float64) int {
+	key := [2]float64{x, y}
+	if i, ok := b.vertexNums[key]; ok {
+		return i
+	}
+	b.vertexes = append(b.vertexes, Vertex{X: x, Y: y})
+	b.vertexNums[key] = len(b.vertexes) - 1
+	return len(b.vertexes) - 1
+}
+
+// bounds returns the bounding box of segs
+func (b *nodeBuilder) bounds(segs []LineSegment) BoundBox {
+	bbox := newBBox()
+	for _, seg := range segs {
+		bbox.add(b.vertexes[seg.V1Num])
+		bbox.add(b.vertexes[seg.V2Num])
+	}
+	return *bbox
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,882 @@
+package wad
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// NodeFormat is the format a level's segs, subsectors and nodes were read from
+type NodeFormat int
+
+const (
+	NodesVanilla NodeFormat = iota
+	NodesZDoom              // ZDoom extended nodes in the NODES lump: XNOD, or ZNOD compressed
+	NodesZDoomGL            // ZDoom extended GL nodes in SSECTORS or ZNODES: XGLN, XGL2 or XGL3
+	NodesGL                 // glBSP GL_VERT, GL_SEGS, GL_SSECT and GL_NODES lumps
+)
+
+// ZDoom extended node signatures. A leading Z in place of the X means the data after the signature
+// is zlib compressed.
+var zdoomNodeSignatures = []string{"XNOD", "XGLN", "XGL2", "XGL3"}
+
+// Extended node children mark subsectors with the top bit
+const extendedSubSectorFlag = 0x80000000
+
+type binZNodeVertex struct {
+	X, Y int32 // 16.16 fixed point
+}
+
+type binZNodeSeg struct {
+	V1, V2 uint32
+	Line   uint16
+	Side   uint8
+}
+
+type binZNodeGLSeg struct {
+	V1, Partner uint32
+	Line        uint16
+	Side        uint8
+}
+
+type binZNodeGL2Seg struct {
+	V1, Partner uint32
+	Line        uint32
+	Side        uint8
+}
+
+type binZNodeNode struct {
+	X, Y, DX, DY         int16
+	BBoxR, BBoxL         binBBox
+	ChildNumR, ChildNumL uint32
+}
+
+type binZNodeNode3 struct {
+	X, Y, DX, DY         int32 // 16.16 fixed point
+	BBoxR, BBoxL         binBBox
+	ChildNumR, ChildNumL uint32
+}
+
+// glBSP GL node versions are identified by a signature at the start of GL_VERT
+const (
+	glVersion1 = 1 // No signature. Vertexes are 16 bit, and GL vertex references set bit 15.
+	glVersion2 = 2 // gNd2: vertexes are fixed point
+	glVersion3 = 3 // gNd3: segs and subsectors are 32 bit, and GL vertex references set bit 30
+	glVersion5 = 5 // gNd5: nodes are 32 bit too, and GL vertex references set bit 31
+)
+
+// GL node lump names in the order they follow their marker
+var glLumpNames = []string{"GL_VERT", "GL_SEGS", "GL_SSECT", "GL_NODES", "GL_PVS"}
+
+type binGLSeg struct {
+	V1, V2  uint16
+	Line    uint16
+	Side    uint16
+	Partner uint16
+}
+
+type binGLSeg3 struct {
+	V1, V2  uint32
+	Line    uint16
+	Side    uint16
+	Partner uint32
+}
+
+type binGLSubSector3 struct {
+	NumSegments      uint32
+	StartLineSegment uint32
+}
+
+type binGLNode5 struct {
+	X, Y, DX, DY         int16
+	BBoxR, BBoxL         binBBox
+	ChildNumR, ChildNumL uint32
+}
+
+// nodeChild converts a vanilla node child to the canonical form, in which subsectors are negative
+func nodeChild(c int16) int {
+	if c < 0 {
+		return int(uint16(c)&math.MaxInt16) | math.MinInt32
+	}
+	return int(c)
+}
+
+// extendedNodeChild converts an extended node child to the canonical form
+func extendedNodeChild(c uint32) int {
+	if c&extendedSubSectorFlag != 0 {
+		return int(c&^extendedSubSectorFlag) | math.MinInt32
+	}
+	return int(c)
+}
+
+// nodeSignature returns the first four bytes of a lump, or "" if it is shorter
+func (w *WAD) nodeSignature(lumpInfo *LumpInfo) string {
+	if lumpInfo.Size < 4 {
+		return ""
+	}
+	var sig [4]byte
+	if _, err := w.lumpReader(lumpInfo).ReadAt(sig[:], 0); err != nil {
+		return ""
+	}
+	return string(sig[:])
+}
+
+// isExtendedNodes reports whether a lump holds ZDoom extended nodes
+func (w *WAD) isExtendedNodes(lumpInfo *LumpInfo) bool {
+	sig := w.nodeSignature(lumpInfo)
+	if sig == "" || sig[0] != 'X' && sig[0] != 'Z' {
+		return false
+	}
+	for _, s := range zdoomNodeSignatures {
+		if sig[1:] == s[1:] {
+			return true
+		}
+	}
+	return false
+}
+
+// readExtendedNodes reads ZDoom extended nodes, replacing the level's segs, subsectors and nodes.
+// The nodes' new vertexes are appended to the level's vertexes.
+func (w *WAD) readExtendedNodes(lumpInfo *LumpInfo, level *Level) error {
+	logger.Println("Reading Extended Nodes ...")
+
+	lump, err := w.readLump(lumpInfo)
+	if err != nil {
+		return err
+	}
+	if len(lump) < 4 {
+		return errors.New("extended nodes truncated")
+	}
+	sig, data := string(lump[:4]), lump[4:]
+	if sig[0] == 'Z' {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%v: %w", sig, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("%v: %w", sig, err)
+		}
+	}
+	reader := bytes.NewReader(data)
+	gl := sig[1:] != "NOD"
+	read := func(data any) error {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return fmt.Errorf("%v: nodes truncated", sig)
+		}
+		return nil
+	}
+	count := func() (int, error) {
+		var n uint32
+		if err := read(&n); err != nil {
+			return 0, err
+		}
+		if int64(n) > int64(len(data)) { // Every entry takes at least a byte
+			return 0, fmt.Errorf("%v: bad count %v", sig, n)
+		}
+		return int(n), nil
+	}
+
+	// Vertexes. Nodebuilders may drop unused vertexes from the end of the map's own.
+	var orgVerts uint32
+	if err := read(&orgVerts); err != nil {
+		return err
+	}
+	if int(orgVerts) > len(level.Vertexes) {
+		return fmt.Errorf("%v: %v original vertexes, but the map has %v", sig, orgVerts,
+			len(level.Vertexes))
+	}
+	numVerts, err := count()
+	if err != nil {
+		return err
+	}
+	newVerts := make([]binZNodeVertex, numVerts)
+	if err := read(newVerts); err != nil {
+		return err
+	}
+	vertexes := level.Vertexes[:orgVerts:orgVerts]
+	for _, v := range newVerts {
+		vertexes = append(vertexes, Vertex{X: fixedToFloat(v.X), Y: fixedToFloat(v.Y)})
+	}
+
+	// Subsectors, whose segs are consecutive
+	numSubSectors, err := count()
+	if err != nil {
+		return err
+	}
+	subSectors := make([]SubSector, numSubSectors)
+	first := 0
+	for i := range subSectors {
+		var n uint32
+		if err := read(&n); err != nil {
+			return err
+		}
+		subSectors[i] = SubSector{numLineSegments: int(n), StartLineSegment: first}
+		first += int(n)
+	}
+
+	// Segs. GL segs only store their first vertex, and end where the next seg in the subsector
+	// starts.
+	numSegs, err := count()
+	if err != nil {
+		return err
+	}
+	if numSegs != first {
+		return fmt.Errorf("%v: %v segs, but subsectors hold %v", sig, numSegs, first)
+	}
+	segs := make([]LineSegment, numSegs)
+	switch sig[1:] {
+	case "NOD":
+		bin := make([]binZNodeSeg, numSegs)
+		if err := read(bin); err != nil {
+			return err
+		}
+		for i, s := range bin {
+			segs[i] = LineSegment{V1Num: int(s.V1), V2Num: int(s.V2), LineNum: int(s.Line),
+				IsSideL: s.Side != 0, PartnerNum: -1}
+		}
+	case "GLN":
+		bin := make([]binZNodeGLSeg, numSegs)
+		if err := read(bin); err != nil {
+			return err
+		}
+		for i, s := range bin {
+			segs[i] = LineSegment{V1Num: int(s.V1), LineNum: int(s.Line), IsSideL: s.Side != 0,
+				PartnerNum: int(int32(s.Partner))}
+			if s.Line == math.MaxUint16 {
+				segs[i].LineNum = -1
+			}
+		}
+	default:
+		bin := make([]binZNodeGL2Seg, numSegs)
+		if err := read(bin); err != nil {
+			return err
+		}
+		for i, s := range bin {
+			segs[i] = LineSegment{V1Num: int(s.V1), LineNum: int(int32(s.Line)), IsSideL: s.Side != 0,
+				PartnerNum: int(int32(s.Partner))}
+		}
+	}
+	if gl {
+		closeSubSectors(subSectors, segs)
+	}
+
+	// Nodes
+	numNodes, err := count()
+	if err != nil {
+		return err
+	}
+	nodes := make([]Node, numNodes)
+	if sig[1:] == "GL3" {
+		bin := make([]binZNodeNode3, numNodes)
+		if err := read(bin); err != nil {
+			return err
+		}
+		for i, n := range bin {
+			nodes[i] = newNode(fixedToFloat(n.X), fixedToFloat(n.Y), fixedToFloat(n.DX),
+				fixedToFloat(n.DY), n.BBoxR, n.BBoxL)
+			nodes[i].ChildNumR = extendedNodeChild(n.ChildNumR)
+			nodes[i].ChildNumL = extendedNodeChild(n.ChildNumL)
+		}
+	} else {
+		bin := make([]binZNodeNode, numNodes)
+		if err := read(bin); err != nil {
+			return err
+		}
+		for i, n := range bin {
+			nodes[i] = newNode(float64(n.X), float64(n.Y), float64(n.DX), float64(n.DY), n.BBoxR,
+				n.BBoxL)
+			nodes[i].ChildNumR = extendedNodeChild(n.ChildNumR)
+			nodes[i].ChildNumL = extendedNodeChild(n.ChildNumL)
+		}
+	}
+
+	level.NodeFormat = NodesZDoom
+	if gl {
+		level.NodeFormat = NodesZDoomGL
+	}
+	level.orgVertexes, level.nodesCompressed = int(orgVerts), sig[0] == 'Z'
+	return setNodes(level, vertexes, segs, subSectors, nodes)
+}
+
+// glMarker returns the index of the marker lump that starts a level's GL nodes, or -1 if there is
+// none. The marker is GL_ followed by the level name, or GL_LEVEL for long names, and either
+// follows the level or is in a separate GWA file.
+func (w *WAD) glMarker(name string, levelEnd int) int {
+	if len(name) <= 5 {
+		if i, ok := w.lumpNums["GL_"+name]; ok {
+			return i
+		}
+	}
+	if levelEnd < len(w.lumpInfos) && w.lumpInfos[levelEnd].Name == "GL_LEVEL" {
+		return levelEnd
+	}
+	return -1
+}
+
+// mapNodes are the nodes a level's map lumps hold, kept when GL nodes replace them
+type mapNodes struct {
+	format       NodeFormat
+	numVertexes  int // Leading vertexes of the level that are not GL vertexes
+	lineSegments []LineSegment
+	subSectors   []SubSector
+	nodes        []Node
+}
+
+// readGLNodes reads a level's glBSP GL nodes, if it has any, replacing the level's segs,
+// subsectors and nodes. The GL vertexes are appended to the level's vertexes. The replaced nodes
+// are kept for MarshalLumps.
+func (w *WAD) readGLNodes(name string, levelEnd int, level *Level) error {
+	marker := w.glMarker(name, levelEnd)
+	if marker < 0 {
+		return nil
+	}
+	logger.Println("Reading GL Nodes ...")
+
+	lumps := map[string][]byte{}
+	for i := marker + 1; i < len(w.lumpInfos); i++ {
+		info := &w.lumpInfos[i]
+		if !slices.Contains(glLumpNames, info.Name) {
+			break
+		}
+		if info.Name == "GL_PVS" {
+			continue
+		}
+		lump, err := w.readLump(info)
+		if err != nil {
+			return err
+		}
+		lumps[info.Name] = lump
+	}
+	for _, lumpName := range glLumpNames[:4] {
+		if _, ok := lumps[lumpName]; !ok {
+			return fmt.Errorf("%v: %v lump not found", name, lumpName)
+		}
+	}
+	read := func(lumpName string, data []byte, bin any) error {
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, bin); err != nil {
+			return fmt.Errorf("%v: %v: %w", name, lumpName, err)
+		}
+		return nil
+	}
+
+	// Vertexes
+	version, vertData := glVersion1, lumps["GL_VERT"]
+	if len(vertData) >= 4 && string(vertData[:3]) == "gNd" {
+		switch vertData[3] {
+		case '2':
+			version = glVersion2
+		case '3':
+			version = glVersion3
+		case '5':
+			version = glVersion5
+		default:
+			return fmt.Errorf("%v: unsupported GL nodes version %q", name, vertData[:4])
+		}
+		vertData = vertData[4:]
+	}
+	vertexes := level.Vertexes[:len(level.Vertexes):len(level.Vertexes)]
+	if version == glVersion1 {
+		bin := make([]binVertex, len(vertData)/4)
+		if err := read("GL_VERT", vertData, bin); err != nil {
+			return err
+		}
+		for _, v := range bin {
+			vertexes = append(vertexes, Vertex{X: float64(v.X), Y: float64(v.Y)})
+		}
+	} else {
+		bin := make([]binZNodeVertex, len(vertData)/8)
+		if err := read("GL_VERT", vertData, bin); err != nil {
+			return err
+		}
+		for _, v := range bin {
+			vertexes = append(vertexes, Vertex{X: fixedToFloat(v.X), Y: fixedToFloat(v.Y)})
+		}
+	}
+
+	// Segs, which may refer to map vertexes or GL vertexes
+	numMapVerts := len(level.Vertexes)
+	vertex := func(v uint32) int {
+		switch {
+		case version <= glVersion2 && v&0x8000 != 0:
+			return numMapVerts + int(v&0x7fff)
+		case version == glVersion3 && v&0x40000000 != 0:
+			return numMapVerts + int(v&0x3fffffff)
+		case version == glVersion5 && v&0x80000000 != 0:
+			return numMapVerts + int(v&0x7fffffff)
+		}
+		return int(v)
+	}
+	segData := lumps["GL_SEGS"]
+	if version == glVersion3 {
+		segData = bytes.TrimPrefix(segData, []byte("gNd3"))
+	}
+	var segs []LineSegment
+	if version <= glVersion2 {
+		bin := make([]binGLSeg, len(segData)/10)
+		if err := read("GL_SEGS", segData, bin); err != nil {
+			return err
+		}
+		for _, s := range bin {
+			seg := LineSegment{V1Num: vertex(uint32(s.V1)), V2Num: vertex(uint32(s.V2)),
+				LineNum: int(s.Line), IsSideL: s.Side != 0, PartnerNum: int(s.Partner)}
+			if s.Line == math.MaxUint16 {
+				seg.LineNum = -1
+			}
+			if s.Partner == math.MaxUint16 {
+				seg.PartnerNum = -1
+			}
+			segs = append(segs, seg)
+		}
+	} else {
+		bin := make([]binGLSeg3, len(segData)/16)
+		if err := read("GL_SEGS", segData, bin); err != nil {
+			return err
+		}
+		for _, s := range bin {
+			seg := LineSegment{V1Num: vertex(s.V1), V2Num: vertex(s.V2), LineNum: int(s.Line),
+				IsSideL: s.Side != 0, PartnerNum: int(int32(s.Partner))}
+			if s.Line == math.MaxUint16 {
+				seg.LineNum = -1
+			}
+			segs = append(segs, seg)
+		}
+	}
+
+	// Subsectors
+	subData := lumps["GL_SSECT"]
+	var subSectors []SubSector
+	if version <= glVersion2 {
+		bin := make([]binSubSector, len(subData)/4)
+		if err := read("GL_SSECT", subData, bin); err != nil {
+			return err
+		}
+		for _, s := range bin {
+			subSectors = append(subSectors, SubSector{numLineSegments: int(uint16(s.NumSegments)),
+				StartLineSegment: int(uint16(s.StartLineSegment))})
+		}
+	} else {
+		if version == glVersion3 {
+			subData = bytes.TrimPrefix(subData, []byte("gNd3"))
+		}
+		bin := make([]binGLSubSector3, len(subData)/8)
+		if err := read("GL_SSECT", subData, bin); err != nil {
+			return err
+		}
+		for _, s := range bin {
+			subSectors = append(subSectors, SubSector{numLineSegments: int(s.NumSegments),
+				StartLineSegment: int(s.StartLineSegment)})
+		}
+	}
+
+	// Nodes
+	nodeData := lumps["GL_NODES"]
+	var nodes []Node
+	if version < glVersion5 {
+		bin := make([]binNode, len(nodeData)/int(binary.Size(binNode{})))
+		if err := read("GL_NODES", nodeData, bin); err != nil {
+			return err
+		}
+		for _, n := range bin {
+			node := newNode(float64(n.X), float64(n.Y), float64(n.DX), float64(n.DY), n.BBoxR,
+				n.BBoxL)
+			node.ChildNumR, node.ChildNumL = nodeChild(n.ChildNumR), nodeChild(n.ChildNumL)
+			nodes = append(nodes, node)
+		}
+	} else {
+		bin := make([]binGLNode5, len(nodeData)/int(binary.Size(binGLNode5{})))
+		if err := read("GL_NODES", nodeData, bin); err != nil {
+			return err
+		}
+		for _, n := range bin {
+			node := newNode(float64(n.X), float64(n.Y), float64(n.DX), float64(n.DY), n.BBoxR,
+				n.BBoxL)
+			node.ChildNumR = extendedNodeChild(n.ChildNumR)
+			node.ChildNumL = extendedNodeChild(n.ChildNumL)
+			nodes = append(nodes, node)
+		}
+	}
+
+	org := &mapNodes{format: level.NodeFormat, numVertexes: len(level.Vertexes),
+		lineSegments: level.LineSegments, subSectors: level.SubSectors, nodes: level.Nodes}
+	if err := setNodes(level, vertexes, segs, subSectors, nodes); err != nil {
+		return err
+	}
+	level.NodeFormat, level.mapNodes = NodesGL, org
+	return nil
+}
+
+// closeSubSectors ends each GL seg where the next seg of its subsector starts, closing the
+// subsector's polygon
+func closeSubSectors(subSectors []SubSector, segs []LineSegment) {
+	for _, s := range subSectors {
+		for j := range s.numLineSegments {
+			next := s.StartLineSegment + (j+1)%s.numLineSegments
+			segs[s.StartLineSegment+j].V2Num = segs[next].V1Num
+		}
+	}
+}
+
+// setNodes checks references between new segs, subsectors and nodes, and stores them in the
+// level. Seg angles and offsets, which extended and GL formats leave out, are calculated from the
+// vertexes.
+func setNodes(level *Level, vertexes []Vertex, segs []LineSegment, subSectors []SubSector,
+	nodes []Node) error {
+	for i := range segs {
+		s := &segs[i]
+		if s.V1Num < 0 || s.V1Num >= len(vertexes) || s.V2Num < 0 || s.V2Num >= len(vertexes) {
+			return fmt.Errorf("seg %v: bad vertex", i)
+		}
+		if s.LineNum >= len(level.Lines) {
+			return fmt.Errorf("seg %v: bad line %v", i, s.LineNum)
+		}
+		v1, v2 := vertexes[s.V1Num], vertexes[s.V2Num]
+		s.Angle = math.Atan2(v2.Y-v1.Y, v2.X-v1.X)
+		if s.Angle < 0 {
+			s.Angle += 2 * math.Pi
+		}
+		if s.LineNum >= 0 {
+			line := &level.Lines[s.LineNum]
+			start := line.V1Num
+			if s.IsSideL {
+				start = line.V2Num
+			}
+			if start >= 0 && start < len(vertexes) {
+				s.Offset = math.Hypot(v1.X-vertexes[start].X, v1.Y-vertexes[start].Y)
+			}
+		}
+	}
+	for i, s := range subSectors {
+		if s.numLineSegments <= 0 || s.StartLineSegment < 0 ||
+			s.StartLineSegment+s.numLineSegments > len(segs) {
+			return fmt.Errorf("subsector %v: bad segs", i)
+		}
+	}
+	for i, n := range nodes {
+		for _, c := range []int{n.ChildNumR, n.ChildNumL} {
+			if c < 0 && c&math.MaxInt32 >= len(subSectors) || c >= len(nodes) {
+				return fmt.Errorf("node %v: bad child", i)
+			}
+		}
+	}
+	if len(nodes) == 0 && len(subSectors) != 1 {
+		return errors.New("no nodes")
+	}
+
+	level.Vertexes = vertexes
+	level.LineSegments = segs
+	level.SubSectors = subSectors
+	level.Nodes = nodes
+	return nil
+}
+
+// newNode creates a node with a partition line and child bounding boxes
+func newNode(x, y, dx, dy float64, bboxR, bboxL binBBox) Node {
+	return Node{
+		X:  x,
+		Y:  y,
+		DX: dx,
+		DY: dy,
+		BBoxR: BoundBox{
+			float64(bboxR.Top),
+			float64(bboxR.Bottom),
+			float64(bboxR.Left),
+			float64(bboxR.Right),
+		},
+		BBoxL: BoundBox{
+			float64(bboxL.Top),
+			float64(bboxL.Bottom),
+			float64(bboxL.Left),
+			float64(bboxL.Right),
+		},
+	}
+}
+
+// fixedToFloat converts a 16.16 fixed point number
+func fixedToFloat(f int32) float64 {
+	return float64(f) / (1 << 16)
+}
+
+// setSubSectorPolygons sets the polygon of each subsector. The segs of GL nodes bound a closed
+// polygon. Otherwise the polygon is found by clipping the map's bounds by the partition lines on
+// the way down the tree, and then by the subsector's segs.
+func setSubSectorPolygons(l *Level) {
+	if len(l.SubSectors) == 0 || len(l.Vertexes) == 0 {
+		return
+	}
+	bbox := newBBox()
+	for _, v := range l.Vertexes {
+		bbox.add(v)
+	}
+	bounds := []Vertex{
+		{X: bbox.Left, Y: bbox.Bottom}, {X: bbox.Left, Y: bbox.Top},
+		{X: bbox.Right, Y: bbox.Top}, {X: bbox.Right, Y: bbox.Bottom},
+	}
+	if l.RootNode == nil {
+		setSubSectorPolygon(&l.SubSectors[0], bounds)
+		return
+	}
+	visited := map[*Node]bool{} // Guards against broken trees with cycles
+	var walk func(n *Node, poly []Vertex)
+	walk = func(n *Node, poly []Vertex) {
+		if visited[n] {
+			return
+		}
+		visited[n] = true
+		for side, child := range []BSPMember{n.ChildR, n.ChildL} {
+			// The right side of the partition line is its front
+			sign := 1.0
+			if side == 1 {
+				sign = -1
+			}
+			clipped := clipPolygon(poly, Vertex{X: n.X, Y: n.Y}, n.DX*sign, n.DY*sign)
+			switch c := child.(type) {
+			case *Node:
+				walk(c, clipped)
+			case *SubSector:
+				setSubSectorPolygon(c, clipped)
+			}
+		}
+	}
+	walk(l.RootNode, bounds)
+}
+
+// setSubSectorPolygon sets a subsector's polygon from its segs if they are closed, or else by
+// clipping the area of its branch of the tree by its segs
+func setSubSectorPolygon(s *SubSector, area []Vertex) {
+	closed := len(s.LineSegments) > 0
+	for j, seg := range s.LineSegments {
+		if seg.V2Num != s.LineSegments[(j+1)%len(s.LineSegments)].V1Num {
+			closed = false
+			break
+		}
+	}
+	if closed {
+		s.Polygon = make([]Vertex, len(s.LineSegments))
+		for j, seg := range s.LineSegments {
+			s.Polygon[j] = Vertex{X: seg.V1.X, Y: seg.V1.Y}
+		}
+		return
+	}
+	for _, seg := range s.LineSegments {
+		area = clipPolygon(area, seg.V1, seg.V2.X-seg.V1.X, seg.V2.Y-seg.V1.Y)
+	}
+	s.Polygon = area
+}
+
+// clipPolygon returns the part of a convex polygon on the right of the line through p with
+// direction (dx, dy)
+func clipPolygon(poly []Vertex, p Vertex, dx, dy float64) []Vertex {
+	const epsilon = 1.0 / (1 << 16)
+	side := func(v Vertex) float64 {
+		return dx*(v.Y-p.Y) - dy*(v.X-p.X) // Negative on the right
+	}
+	var clipped []Vertex
+	for i, a := range poly {
+		b := poly[(i+1)%len(poly)]
+		sa, sb := side(a), side(b)
+		if sa <= epsilon {
+			clipped = append(clipped, a)
+		}
+		if sa < -epsilon && sb > epsilon || sa > epsilon && sb < -epsilon {
+			t := sa / (sa - sb)
+			clipped = append(clipped, Vertex{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)})
+		}
+	}
+	return clipped
+}
+
+// EncodeNodes serializes the level's vertexes, segs, subsectors and nodes as VERTEXES, SEGS,
+// SSECTORS and NODES lumps, for use with Writer.SetMap. NodesVanilla rounds vertexes created by
+// seg splits to whole map units. NodesZDoom keeps them in fixed point in an XNOD NODES lump, or a
+// zlib compressed ZNOD one if compress is set, and leaves SEGS and SSECTORS empty.
+func (l *Level) EncodeNodes(format NodeFormat, compress bool) ([]Lump, error) {
+	for i, s := range l.LineSegments {
+		if s.LineNum < 0 {
+			return nil, fmt.Errorf("seg %v: minisegs cannot be encoded", i)
+		}
+	}
+	switch format {
+	case NodesVanilla:
+		return l.encodeVanillaNodes()
+	case NodesZDoom:
+		return l.encodeExtendedNodes(compress)
+	}
+	return nil, fmt.Errorf("encoding node format %v is not supported", format)
+}
+
+// encodeVanillaNodes serializes nodes in the vanilla format
+func (l *Level) encodeVanillaNodes() ([]Lump, error) {
+	if len(l.Vertexes) > math.MaxInt16 || len(l.LineSegments) > math.MaxInt16 ||
+		len(l.SubSectors) > math.MaxInt16 || len(l.Nodes) > math.MaxInt16 {
+		return nil, errors.New("too many vertexes, segs, subsectors or nodes for vanilla nodes")
+	}
+
+	vertexes := make([]binVertex, len(l.Vertexes))
+	for i, v := range l.Vertexes {
+		vertexes[i] = binVertex{int16(math.Round(v.X)), int16(math.Round(v.Y))}
+	}
+	segs := make([]binLineSegment, len(l.LineSegments))
+	for i, s := range l.LineSegments {
+		segs[i] = binLineSegment{
+			V1:      int16(s.V1Num),
+			V2:      int16(s.V2Num),
+			Angle:   radiansToWadBam(s.Angle),
+			LineNum: int16(s.LineNum),
+			Offset:  int16(math.Round(s.Offset)),
+		}
+		if s.IsSideL {
+			segs[i].Direction = 1
+		}
+	}
+	subSectors := make([]binSubSector, len(l.SubSectors))
+	for i, s := range l.SubSectors {
+		subSectors[i] = binSubSector{int16(s.numLineSegments), int16(s.StartLineSegment)}
+	}
+	nodes := make([]binNode, len(l.Nodes))
+	for i, n := range l.Nodes {
+		nodes[i] = binNode{
+			X:         int16(math.Round(n.X)),
+			Y:         int16(math.Round(n.Y)),
+			DX:        int16(math.Round(n.DX)),
+			DY:        int16(math.Round(n.DY)),
+			BBoxR:     bBoxToBin(n.BBoxR),
+			BBoxL:     bBoxToBin(n.BBoxL),
+			ChildNumR: int16(vanillaNodeChild(n.ChildNumR)),
+			ChildNumL: int16(vanillaNodeChild(n.ChildNumL)),
+		}
+	}
+
+	lumps := []Lump{
+		{Name: "VERTEXES", Data: encode(vertexes)},
+		{Name: "SEGS", Data: encode(segs)},
+		{Name: "SSECTORS", Data: encode(subSectors)},
+		{Name: "NODES", Data: encode(nodes)},
+	}
+	return lumps, nil
+}
+
+// encodeExtendedNodes serializes nodes in the ZDoom extended format. Vertexes added by the node
+// builder, or else those after the last one used by a line, are written to the NODES lump.
+func (l *Level) encodeExtendedNodes(compress bool) ([]Lump, error) {
+	orgVerts := l.orgVertexes
+	if orgVerts == 0 {
+		for _, line := range l.Lines {
+			orgVerts = max(orgVerts, line.V1Num+1, line.V2Num+1)
+		}
+	}
+	orgVerts = min(orgVerts, len(l.Vertexes))
+
+	var nodeData bytes.Buffer
+	write := func(data any) {
+		binary.Write(&nodeData, binary.LittleEndian, data)
+	}
+	write(uint32(orgVerts))
+	write(uint32(len(l.Vertexes) - orgVerts))
+	for _, v := range l.Vertexes[orgVerts:] {
+		write(binZNodeVertex{floatToFixed(v.X), floatToFixed(v.Y)})
+	}
+	write(uint32(len(l.SubSectors)))
+	first := 0
+	for i, s := range l.SubSectors {
+		if s.StartLineSegment != first {
+			return nil, fmt.Errorf("subsector %v: segs are not in subsector order", i)
+		}
+		write(uint32(s.numLineSegments))
+		first += s.numLineSegments
+	}
+	write(uint32(len(l.LineSegments)))
+	for _, s := range l.LineSegments {
+		seg := binZNodeSeg{V1: uint32(s.V1Num), V2: uint32(s.V2Num), Line: uint16(s.LineNum)}
+		if s.IsSideL {
+			seg.Side = 1
+		}
+		write(seg)
+	}
+	write(uint32(len(l.Nodes)))
+	for _, n := range l.Nodes {
+		write(binZNodeNode{
+			X:         int16(math.Round(n.X)),
+			Y:         int16(math.Round(n.Y)),
+			DX:        int16(math.Round(n.DX)),
+			DY:        int16(math.Round(n.DY)),
+			BBoxR:     bBoxToBin(n.BBoxR),
+			BBoxL:     bBoxToBin(n.BBoxL),
+			ChildNumR: uint32(extendedNodeChildToBin(n.ChildNumR)),
+			ChildNumL: uint32(extendedNodeChildToBin(n.ChildNumL)),
+		})
+	}
+
+	sig, data := "XNOD", nodeData.Bytes()
+	if compress {
+		var zdata bytes.Buffer
+		zw := zlib.NewWriter(&zdata)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		sig, data = "ZNOD", zdata.Bytes()
+	}
+
+	vertexes := make([]binVertex, orgVerts)
+	for i, v := range l.Vertexes[:orgVerts] {
+		vertexes[i] = binVertex{int16(math.Round(v.X)), int16(math.Round(v.Y))}
+	}
+	lumps := []Lump{
+		{Name: "VERTEXES", Data: encode(vertexes)},
+		{Name: "SEGS", Data: []byte{}},
+		{Name: "SSECTORS", Data: []byte{}},
+		{Name: "NODES", Data: append([]byte(sig), data...)},
+	}
+	return lumps, nil
+}
+
+// vanillaNodeChild converts a canonical node child to the vanilla form, with subsectors marked by
+// bit 15
+func vanillaNodeChild(c int) uint16 {
+	if c < 0 {
+		return uint16(c&math.MaxInt32) | 0x8000
+	}
+	return uint16(c)
+}
+
+// extendedNodeChildToBin converts a canonical node child to the extended form
+func extendedNodeChildToBin(c int) uint32 {
+	if c < 0 {
+		return uint32(c&math.MaxInt32) | extendedSubSectorFlag
+	}
+	return uint32(c)
+}
+
+// bBoxToBin rounds a bounding box outwards to whole map units
+func bBoxToBin(b BoundBox) binBBox {
+	return binBBox{
+		Top:    int16(math.Ceil(b.Top)),
+		Bottom: int16(math.Floor(b.Bottom)),
+		Left:   int16(math.Floor(b.Left)),
+		Right:  int16(math.Ceil(b.Right)),
+	}
+}
+
+// floatToFixed converts to 16.16 fixed point
+func floatToFixed(f float64) int32 {
+	return int32(math.Round(f * (1 << 16)))
+}
+
+// radiansToWadBam converts an angle in radians to a binary angle, the inverse of wadBamToRadians
+func radiansToWadBam(r float64) uint16 {
+	return uint16(math.Round(r * math.MaxUint16 / (2 * math.Pi)))
+}
+
+// encode serializes fixed size data in little endian order
+func encode(data any) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, data)
+	return buf.Bytes()
+}
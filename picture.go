@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
 	"strings"
 )
 
@@ -14,33 +18,30 @@ type binPatchImageHeader struct {
 // Read a picture lump
 func (w *WAD) GetPicture(name string) (*Picture, error) {
 	name = strings.ToUpper(name)
+	return cached(w, w.Pictures, name, func() (*Picture, error) {
+		return w.readPicture(name)
+	})
+}
 
-	// If cache hit, return it
-	if w.Pictures == nil {
-		w.Pictures = make(map[string]*Picture)
-	} else if p, ok := w.Pictures[name]; ok {
-		return p, nil
-	}
+// numPictures returns the number of cached pictures
+func (w *WAD) numPictures() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.Pictures)
+}
 
+// readPicture decodes a picture lump
+func (w *WAD) readPicture(name string) (*Picture, error) {
 	lumpNum, ok := w.lumpNums[name]
 	if !ok {
 		return nil, fmt.Errorf("%v lump not found", name)
 	}
 
-	lumpInfo := w.lumpInfos[lumpNum]
-	if err := w.seek(int64(lumpInfo.Filepos)); err != nil {
-		return nil, err
-	}
-
 	// Read lump
-	lump := make([]byte, lumpInfo.Size)
-	n, err := w.file.Read(lump)
+	lump, err := w.readLump(&w.lumpInfos[lumpNum])
 	if err != nil {
 		return nil, err
 	}
-	if n != lumpInfo.Size {
-		return nil, fmt.Errorf("truncated lump")
-	}
 
 	// Read patch lump header
 	reader := bytes.NewBuffer(lump)
@@ -48,6 +49,9 @@ func (w *WAD) GetPicture(name string) (*Picture, error) {
 	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
 		return nil, err
 	}
+	if header.Width < 0 || header.Height < 0 {
+		return nil, fmt.Errorf("%v: bad picture size", name)
+	}
 
 	// Initialise rectangular picture space to transparent
 	columns := make([]Column, header.Width)
@@ -65,18 +69,37 @@ func (w *WAD) GetPicture(name string) (*Picture, error) {
 	}
 
 	// For each column offset, expand out the posts into columns
+	// A top delta no greater than the previous post's top is relative to it. This is the DeePsea
+	// convention for pictures taller than 254 pixels, and never occurs in vanilla pictures.
 	for columnIndex, offset := range offsets {
+		top := -1
 		for {
+			if offset < 0 || int(offset) >= len(lump) {
+				return nil, fmt.Errorf("%v: bad picture column", name)
+			}
 			topDelta := int(lump[offset])
 			offset += 1
 			if topDelta == 255 {
 				break
 			}
+			if topDelta <= top {
+				top += topDelta
+			} else {
+				top = topDelta
+			}
+			if int(offset)+2 >= len(lump) {
+				return nil, fmt.Errorf("%v: bad picture column", name)
+			}
 			numPixels := int(lump[offset])
 			offset += 1
 			offset += 1 // Padding
+			if int(offset)+numPixels > len(lump) {
+				return nil, fmt.Errorf("%v: bad picture post", name)
+			}
 			for i := range numPixels {
-				columns[columnIndex][topDelta+i] = lump[offset]
+				if top+i < int(header.Height) {
+					columns[columnIndex][top+i] = lump[offset]
+				}
 				offset += 1
 			}
 			offset += 1 // Padding
@@ -85,15 +108,14 @@ func (w *WAD) GetPicture(name string) (*Picture, error) {
 
 	// Create picture
 	pic := &Picture{
-		Name:       name,
-		Width:      int(header.Width),
-		Height:     int(header.Height),
-		LeftOffset: int(header.LeftOffset),
-		TopOffset:  int(header.TopOffset),
-		Columns:    columns}
-
-	// Cache picture
-	w.Pictures[name] = pic
+		Name:             name,
+		Width:            int(header.Width),
+		Height:           int(header.Height),
+		LeftOffset:       int(header.LeftOffset),
+		TopOffset:        int(header.TopOffset),
+		Columns:          columns,
+		TransparentIndex: w.TransparentIndex,
+	}
 
 	// Return pic
 	return pic, nil
@@ -104,3 +126,169 @@ func (w *WAD) GetPictureOrNil(name string) *Picture {
 	p, _ := w.GetPicture(name)
 	return p
 }
+
+// maxPostLength is the longest post written by Encode. Longer runs are split into several posts.
+const maxPostLength = 254
+
+// NewPictureFromImage creates a picture from an image, matching each pixel to the nearest color in
+// pal. Pixels that are more than half transparent are left uncovered, and are set to
+// transparentIndex, which opaque pixels never use.
+func NewPictureFromImage(img image.Image, pal *Palette, transparentIndex byte) *Picture {
+	bounds := img.Bounds()
+	pic := &Picture{
+		Width:            bounds.Dx(),
+		Height:           bounds.Dy(),
+		Columns:          make([]Column, bounds.Dx()),
+		TransparentIndex: transparentIndex,
+	}
+	nearest := make(map[color.RGBA]byte)
+	for x := range pic.Columns {
+		pic.Columns[x] = make(Column, pic.Height)
+		for y := range pic.Columns[x] {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			if a < 0x8000 {
+				pic.Columns[x][y] = transparentIndex
+				continue
+			}
+
+			// Undo alpha premultiplication
+			c := color.RGBA{byte(r * 0xff / a), byte(g * 0xff / a), byte(b * 0xff / a), 0xff}
+			index, ok := nearest[c]
+			if !ok {
+				index = pal.nearest(c, transparentIndex)
+				nearest[c] = index
+			}
+			pic.Columns[x][y] = index
+		}
+	}
+	return pic
+}
+
+// nearest returns the index of the palette color closest to c, never returning exclude
+func (pal *Palette) nearest(c color.RGBA, exclude byte) byte {
+	best, bestDist := 0, math.MaxInt
+	for i, p := range pal {
+		if byte(i) == exclude {
+			continue
+		}
+		dr, dg, db := int(p.Red)-int(c.R), int(p.Green)-int(c.G), int(p.Blue)-int(c.B)
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return byte(best)
+}
+
+// Encode converts the picture to a picture lump. Each column is written as posts of pixels that
+// are not TransparentIndex. Pictures taller than 254 pixels use DeePsea relative top deltas.
+func (p *Picture) Encode() ([]byte, error) {
+	if p.Width < 0 || p.Width > math.MaxInt16 || p.Height < 0 || p.Height > math.MaxInt16 ||
+		len(p.Columns) != p.Width {
+		return nil, fmt.Errorf("%v: bad picture size", p.Name)
+	}
+	header := binPatchImageHeader{
+		Width:      int16(p.Width),
+		Height:     int16(p.Height),
+		LeftOffset: int16(p.LeftOffset),
+		TopOffset:  int16(p.TopOffset),
+	}
+
+	// Build column data, recording the offset of each column
+	var columns bytes.Buffer
+	offsets := make([]int32, p.Width)
+	dataStart := 8 + 4*p.Width
+	for x, column := range p.Columns {
+		offsets[x] = int32(dataStart + columns.Len())
+		top := -1
+		for y := 0; y < len(column); {
+			if column[y] == p.TransparentIndex {
+				y++
+				continue
+			}
+			end := y
+			for end < len(column) && end-y < maxPostLength && column[end] != p.TransparentIndex {
+				end++
+			}
+
+			// A post is reached by an absolute top delta, or by one relative to the previous top
+			// that is no greater than it. Otherwise step down with empty posts.
+			absolute := y <= maxPostLength
+			for !absolute && y-top > min(top, maxPostLength) {
+				columns.Write([]byte{maxPostLength, 0, 0, 0})
+				if top < maxPostLength {
+					top = maxPostLength
+				} else {
+					top += maxPostLength
+				}
+			}
+			topDelta := y
+			if !absolute {
+				topDelta = y - top
+			}
+			top = y
+
+			// Post header, padding, pixels, padding
+			columns.Write([]byte{byte(topDelta), byte(end - y), column[y]})
+			columns.Write(column[y:end])
+			columns.WriteByte(column[end-1])
+			y = end
+		}
+		columns.WriteByte(0xff)
+	}
+	if dataStart+columns.Len() > math.MaxInt32 {
+		return nil, fmt.Errorf("%v: picture too large", p.Name)
+	}
+
+	var lump bytes.Buffer
+	binary.Write(&lump, binary.LittleEndian, &header)
+	binary.Write(&lump, binary.LittleEndian, offsets)
+	lump.Write(columns.Bytes())
+	return lump.Bytes(), nil
+}
+
+// EncodePicture converts an image to a picture lump, matching colors to pal. Pixels that are more
+// than half transparent are left uncovered.
+func EncodePicture(img image.Image, pal *Palette) ([]byte, error) {
+	return NewPictureFromImage(img, pal, DefaultTransparentIndex).Encode()
+}
+
+// EncodePNGPicture converts PNG data to a picture lump, as for EncodePicture. The picture offsets
+// are taken from a ZDoom grAb chunk when present.
+func EncodePNGPicture(data []byte, pal *Palette) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	pic := NewPictureFromImage(img, pal, DefaultTransparentIndex)
+	pic.LeftOffset, pic.TopOffset, _ = PNGGrabOffsets(data)
+	return pic.Encode()
+}
+
+// PNGGrabOffsets returns the picture offsets stored in a ZDoom grAb chunk of PNG data
+func PNGGrabOffsets(data []byte) (left, top int, ok bool) {
+	const signatureSize = 8
+	if len(data) < signatureSize {
+		return 0, 0, false
+	}
+	for pos := signatureSize; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		body := data[pos+8:]
+		if length < 0 || length > len(body) {
+			return 0, 0, false
+		}
+		switch chunkType {
+		case "grAb":
+			if length < 8 {
+				return 0, 0, false
+			}
+			left = int(int32(binary.BigEndian.Uint32(body)))
+			top = int(int32(binary.BigEndian.Uint32(body[4:])))
+			return left, top, true
+		case "IDAT", "IEND":
+			return 0, 0, false // grAb precedes the image data
+		}
+		pos += 8 + length + 4 // Length, type, data and CRC
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,414 @@
+package wad
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// RejectMode selects how BuildReject decides which sectors can see each other
+type RejectMode int
+
+const (
+	RejectAllVisible  RejectMode = iota // Every sector can see every other, so nothing is rejected
+	RejectLineOfSight                   // Sectors see each other only through two-sided lines
+)
+
+// Clipped portals shorter than this are closed
+const rejectEpsilon = 1.0 / 256
+
+// rejectPortal is a two-sided line seen from one of its sectors. A and B are ordered so that the
+// sector it leads from is on the right.
+type rejectPortal struct {
+	A, B     Vertex
+	LineNum  int
+	From, To int
+}
+
+// BuildReject builds the level's reject table. With RejectLineOfSight, a sector can see another if
+// some straight line leads from one to the other through two-sided lines, regardless of heights,
+// so that doors and lifts may open. One-sided lines are assumed not to block, so a sector is
+// never rejected wrongly, and the table is made symmetric.
+//
+// Line of sight is found by following chains of portals, the two-sided lines, out from each
+// portal of each sector, narrowing the view through each. A chain is dropped once every portal
+// that might be seen through it leads to a sector already seen, or once it reaches a portal
+// through a part already reached by other chains. Each portal is then reached only a few times
+// from each source portal, so time grows with the number of portals times the number each can
+// see: seconds for an open map of a thousand sectors that all see each other, and much less for
+// the usual closed map. Memory grows with the square of the number of two-sided lines, a bit for
+// each pair of portals.
+func BuildReject(level *Level, mode RejectMode) error {
+	numSectors := len(level.Sectors)
+	visible := make([][]bool, numSectors)
+	for i := range visible {
+		visible[i] = make([]bool, numSectors)
+		visible[i][i] = true
+	}
+
+	if mode == RejectAllVisible {
+		for i := range visible {
+			for j := range visible[i] {
+				visible[i][j] = true
+			}
+		}
+	} else {
+		portals, err := rejectPortals(level)
+		if err != nil {
+			return err
+		}
+		f := newRejectFlow(portals, numSectors, len(level.Lines))
+		for s := range numSectors {
+			// Sight is symmetric, so start with the sectors already found to see this one
+			for t := range s {
+				visible[s][t] = visible[t][s]
+			}
+			f.flowSector(s, visible[s])
+		}
+	}
+
+	reject := make(Reject, numSectors)
+	for i := range reject {
+		reject[i] = make([]bool, numSectors)
+		for j := range reject[i] {
+			reject[i][j] = !visible[i][j] && !visible[j][i]
+		}
+	}
+	level.Reject = reject
+	return nil
+}
+
+// rejectFlow is the state of the search for the sectors that can see each other
+type rejectFlow struct {
+	portals  []rejectPortal
+	from     [][]int        // The portals leading from each sector
+	into     [][]int        // The portals leading into each sector
+	mightSee []bitSet       // The portals that might be seen through each portal
+	onPath   []bool         // The lines of the portals on the current chain, by line number
+	visible  []bool         // The sectors seen from the current sector
+	unseen   bitSet         // The portals leading into sectors not yet seen
+	source   int            // The portal the current chains start from
+	windows  [][][2]float64 // The parts of each portal reached from the source portal
+	reached  []int          // The portals with windows, to clear for the next source portal
+}
+
+// newRejectFlow indexes the portals and finds what might be seen through each
+func newRejectFlow(portals []rejectPortal, numSectors, numLines int) *rejectFlow {
+	f := &rejectFlow{
+		portals:  portals,
+		from:     make([][]int, numSectors),
+		into:     make([][]int, numSectors),
+		mightSee: make([]bitSet, len(portals)),
+		onPath:   make([]bool, numLines),
+		unseen:   newBitSet(len(portals)),
+		windows:  make([][][2]float64, len(portals)),
+	}
+	for i, p := range portals {
+		f.from[p.From] = append(f.from[p.From], i)
+		f.into[p.To] = append(f.into[p.To], i)
+	}
+	for i := range portals {
+		f.mightSee[i] = f.floodMightSee(i)
+	}
+	return f
+}
+
+// floodMightSee returns the portals that might be seen through a portal: those that can be reached
+// from it through portals that are in front of it and have it behind them, as a line of sight
+// through it must pass through such portals only
+func (f *rejectFlow) floodMightSee(p int) bitSet {
+	mightSee := newBitSet(len(f.portals))
+	source := &f.portals[p]
+	queue := []int{p}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		for _, next := range f.from[f.portals[q].To] {
+			target := &f.portals[next]
+			if mightSee.has(next) || target.LineNum == source.LineNum ||
+				!portalFacing(source, target) {
+				continue
+			}
+			mightSee.set(next)
+			queue = append(queue, next)
+		}
+	}
+	return mightSee
+}
+
+// portalFacing reports whether a target portal might be seen through a source portal: part of
+// the target is in front of the source, and part of the source is behind the target
+func portalFacing(source, target *rejectPortal) bool {
+	return max(lineSide(target.A, source.A, source.B), lineSide(target.B, source.A, source.B)) >
+		-rejectEpsilon &&
+		min(lineSide(source.A, target.A, target.B), lineSide(source.B, target.A, target.B)) <
+			rejectEpsilon
+}
+
+// lineSide returns the distance of a point to the left of the line from p1 to p2, or zero if the
+// line has no length
+func lineSide(v, p1, p2 Vertex) float64 {
+	dx, dy := p2.X-p1.X, p2.Y-p1.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return 0
+	}
+	return (dx*(v.Y-p1.Y) - dy*(v.X-p1.X)) / length
+}
+
+// flowSector marks the sectors that can be seen from a sector, adding to those already marked
+func (f *rejectFlow) flowSector(s int, visible []bool) {
+	f.visible = visible
+	f.unseen.setAll(len(f.portals))
+	for t, seen := range visible {
+		if seen {
+			for _, p := range f.into[t] {
+				f.unseen.clear(p)
+			}
+		}
+	}
+	for _, si := range f.from[s] {
+		source := &f.portals[si]
+		f.source = si
+		for _, p := range f.reached {
+			f.windows[p] = f.windows[p][:0]
+		}
+		f.reached = f.reached[:0]
+		f.see(source.To)
+		f.onPath[source.LineNum] = true
+		for _, pi := range f.from[source.To] {
+			pass := &f.portals[pi]
+			if f.onPath[pass.LineNum] || !f.mightSee[si].has(pi) {
+				continue
+			}
+			a, b, ok := clipSegment(pass.A, pass.B, source.A, source.B)
+			if !ok {
+				continue
+			}
+			f.see(pass.To)
+			if !f.mightSeeUnseen(pi) || f.explored(pi, a, b) {
+				continue // Nothing new can be seen through the pass portal
+			}
+			f.onPath[pass.LineNum] = true
+			f.flow(source, &rejectPortal{a, b, pass.LineNum, pass.From, pass.To}, pi)
+			f.onPath[pass.LineNum] = false
+		}
+		f.onPath[source.LineNum] = false
+	}
+}
+
+// see marks a sector as seen from the current sector
+func (f *rejectFlow) see(s int) {
+	if f.visible[s] {
+		return
+	}
+	f.visible[s] = true
+	for _, p := range f.into[s] {
+		f.unseen.clear(p)
+	}
+}
+
+// explored reports whether the part of a portal from a to b has already been reached from the
+// source portal, and otherwise records it. Every line through the part then passes through parts
+// already reached, so nothing more can be seen through it.
+func (f *rejectFlow) explored(p int, a, b Vertex) bool {
+	portal := &f.portals[p]
+	dx, dy := portal.B.X-portal.A.X, portal.B.Y-portal.A.Y
+	length2 := dx*dx + dy*dy
+	t0 := ((a.X-portal.A.X)*dx + (a.Y-portal.A.Y)*dy) / length2
+	t1 := ((b.X-portal.A.X)*dx + (b.Y-portal.A.Y)*dy) / length2
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+
+	// Windows are kept sorted and merged, so a covered part lies within one of them
+	const slack = 1e-9
+	windows := f.windows[p]
+	for _, w := range windows {
+		if w[0] <= t0+slack && w[1] >= t1-slack {
+			return true
+		}
+	}
+	if len(windows) == 0 {
+		f.reached = append(f.reached, p)
+	}
+	merged := windows[:0:0]
+	for _, w := range windows {
+		if w[1] < t0-slack || w[0] > t1+slack {
+			merged = append(merged, w)
+		} else {
+			t0, t1 = min(t0, w[0]), max(t1, w[1])
+		}
+	}
+	merged = append(merged, [2]float64{t0, t1})
+	slices.SortFunc(merged, func(x, y [2]float64) int { return cmp.Compare(x[0], y[0]) })
+	f.windows[p] = merged
+	return false
+}
+
+// mightSeeUnseen reports whether any portal that might be seen through both the source portal
+// and a pass portal leads to a sector not yet seen
+func (f *rejectFlow) mightSeeUnseen(pass int) bool {
+	source, through := f.mightSee[f.source], f.mightSee[pass]
+	for i := range f.unseen {
+		if source[i]&through[i]&f.unseen[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectPortals returns both directions of each two-sided line
+func rejectPortals(level *Level) ([]rejectPortal, error) {
+	sector := func(line, side int) (int, error) {
+		if side < 0 || side >= len(level.Sides) {
+			return 0, fmt.Errorf("line %v: bad side %v", line, side)
+		}
+		s := level.Sides[side].SectorNum
+		if s < 0 || s >= len(level.Sectors) {
+			return 0, fmt.Errorf("side %v: bad sector %v", side, s)
+		}
+		return s, nil
+	}
+	var portals []rejectPortal
+	for i, line := range level.Lines {
+		if line.SideRNum < 0 || line.SideLNum < 0 {
+			continue
+		}
+		if !level.validVertexes(&line) {
+			return nil, fmt.Errorf("line %v: bad vertex", i)
+		}
+		front, err := sector(i, line.SideRNum)
+		if err != nil {
+			return nil, err
+		}
+		back, err := sector(i, line.SideLNum)
+		if err != nil {
+			return nil, err
+		}
+		v1, v2 := level.Vertexes[line.V1Num], level.Vertexes[line.V2Num]
+		portals = append(portals,
+			rejectPortal{v1, v2, i, front, back},
+			rejectPortal{v2, v1, i, back, front})
+	}
+	return portals, nil
+}
+
+// flow marks the sectors that can be seen from a source portal through a pass portal, which has
+// been clipped to the part visible through the portals before it. The portals after the pass
+// portal are clipped to the lines that separate the source and pass portals, and followed in turn
+// while any might show a sector not yet seen.
+func (f *rejectFlow) flow(source, pass *rejectPortal, passNum int) {
+	seps := separators(source, pass)
+	for _, ti := range f.from[pass.To] {
+		target := &f.portals[ti]
+		if f.onPath[target.LineNum] || !f.mightSee[f.source].has(ti) ||
+			!f.mightSee[passNum].has(ti) {
+			continue
+		}
+		a, b, ok := clipSegment(target.A, target.B, pass.A, pass.B)
+		if ok {
+			a, b, ok = clipSegment(a, b, source.A, source.B)
+		}
+		for _, sep := range seps {
+			if ok {
+				a, b, ok = clipSegment(a, b, sep[0], sep[1])
+			}
+		}
+		if !ok {
+			continue
+		}
+		f.see(target.To)
+		if !f.mightSeeUnseen(ti) || f.explored(ti, a, b) {
+			continue
+		}
+		f.onPath[target.LineNum] = true
+		f.flow(source, &rejectPortal{a, b, target.LineNum, target.From, target.To}, ti)
+		f.onPath[target.LineNum] = false
+	}
+}
+
+// separators returns the lines through an end of the source portal and an end of the pass portal
+// that have the two portals on opposite sides. Each is directed so that what can be seen through
+// both portals is on its left.
+func separators(source, pass *rejectPortal) [][2]Vertex {
+	var lines [][2]Vertex
+	for _, s := range [2][2]Vertex{{source.A, source.B}, {source.B, source.A}} {
+		for _, p := range [2][2]Vertex{{pass.A, pass.B}, {pass.B, pass.A}} {
+			p1, p2 := s[0], p[0]
+			dx, dy := p2.X-p1.X, p2.Y-p1.Y
+			if math.Hypot(dx, dy) < rejectEpsilon {
+				continue
+			}
+			sideS := dx*(s[1].Y-p1.Y) - dy*(s[1].X-p1.X)
+			sideP := dx*(p[1].Y-p1.Y) - dy*(p[1].X-p1.X)
+			switch {
+			case sideS > 0 && sideP < 0:
+				lines = append(lines, [2]Vertex{p2, p1}) // Reversed to put the pass side on the left
+			case sideS < 0 && sideP > 0:
+				lines = append(lines, [2]Vertex{p1, p2})
+			}
+		}
+	}
+	return lines
+}
+
+// clipSegment returns the part of the segment from a to b on the left of the line from p1 to p2,
+// or false if less than rejectEpsilon of it is left
+func clipSegment(a, b, p1, p2 Vertex) (Vertex, Vertex, bool) {
+	dx, dy := p2.X-p1.X, p2.Y-p1.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return a, b, true
+	}
+	sideA := (dx*(a.Y-p1.Y) - dy*(a.X-p1.X)) / length
+	sideB := (dx*(b.Y-p1.Y) - dy*(b.X-p1.X)) / length
+	switch {
+	case sideA <= 0 && sideB <= 0:
+		return a, b, false
+	case sideA < 0:
+		t := sideA / (sideA - sideB)
+		a = Vertex{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+	case sideB < 0:
+		t := sideA / (sideA - sideB)
+		b = Vertex{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+	}
+	return a, b, math.Hypot(b.X-a.X, b.Y-a.Y) >= rejectEpsilon
+}
+
+// EncodeReject serializes the level's reject table as a REJECT lump, with a bit set for each pair
+// of sectors that cannot see each other
+func (l *Level) EncodeReject() Lump {
+	n := len(l.Reject)
+	data := make([]byte, (n*n+7)/8)
+	for i, row := range l.Reject {
+		for j, rejected := range row {
+			if rejected {
+				cell := i*n + j
+				data[cell/8] |= 1 << (cell % 8)
+			}
+		}
+	}
+	return Lump{Name: "REJECT", Data: data}
+}
+
+// bitSet is a set of small non-negative integers
+type bitSet []uint64
+
+// newBitSet returns an empty set with room for the integers below n
+func newBitSet(n int) bitSet {
+	return make(bitSet, (n+63)/64)
+}
+
+func (b bitSet) has(i int) bool { return b[i/64]&(1<<(i%64)) != 0 }
+func (b bitSet) set(i int)      { b[i/64] |= 1 << (i % 64) }
+func (b bitSet) clear(i int)    { b[i/64] &^= 1 << (i % 64) }
+
+// setAll adds the integers below n
+func (b bitSet) setAll(n int) {
+	clear(b)
+	for i := range n {
+		b.set(i)
+	}
+}
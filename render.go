@@ -0,0 +1,453 @@
+package wad
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// RenderOptions controls how RenderSVG and RenderImage draw a level. The image size, however it
+// is set, may be at most MaxRenderPixels.
+type RenderOptions struct {
+	// Width and Height are the image size in pixels, into which the map is fitted. Zero means
+	// 1024. They are ignored if Scale is set.
+	Width, Height int
+
+	// Scale is the number of pixels per map unit. Zero fits the map to Width and Height.
+	Scale float64
+
+	// Margin is the border in pixels around the map
+	Margin int
+
+	// Things draws a mark for each thing, colored by ThingCategory
+	Things bool
+
+	// SectorFills fills each sector with the average color of its floor flat, using Palette. The
+	// level needs nodes, as the fills are drawn from the subsector polygons.
+	SectorFills bool
+	Palette     *Palette
+
+	// Nodes overlays each node's partition line, clipped to the node's bounding boxes
+	Nodes bool
+
+	// BlockMap overlays the block map grid
+	BlockMap bool
+}
+
+// MaxRenderPixels is the largest image size, in pixels, that the level is rendered at
+const MaxRenderPixels = 1 << 26
+
+// Automap colors, as in Doom's automap with the all map cheat
+var (
+	renderBackground    = color.RGBA{0, 0, 0, 0xff}
+	renderWall          = color.RGBA{0xfc, 0, 0, 0xff}       // One-sided
+	renderFloorChange   = color.RGBA{0xbc, 0x78, 0x48, 0xff} // Two-sided with a floor height change
+	renderCeilingChange = color.RGBA{0xfc, 0xfc, 0, 0xff}    // Two-sided with a ceiling height change
+	renderNoChange      = color.RGBA{0x80, 0x80, 0x80, 0xff} // Two-sided with no height change
+	renderSecret        = color.RGBA{0xfc, 0, 0xfc, 0xff}
+	renderNeverMap      = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	renderPartition     = color.RGBA{0, 0xa0, 0xfc, 0xff}
+	renderGrid          = color.RGBA{0x30, 0x30, 0x30, 0xff}
+)
+
+// Thing mark colors by category
+var renderThingColors = map[ThingCategory]color.RGBA{
+	ThingPlayer:     {0, 0xfc, 0, 0xff},
+	ThingMonster:    {0xfc, 0x60, 0x60, 0xff},
+	ThingWeapon:     {0xfc, 0xa0, 0, 0xff},
+	ThingAmmo:       {0xd0, 0xd0, 0x50, 0xff},
+	ThingPowerup:    {0x50, 0x80, 0xfc, 0xff},
+	ThingKey:        {0xfc, 0xfc, 0xfc, 0xff},
+	ThingDecoration: {0x90, 0x70, 0x50, 0xff},
+	ThingOther:      {0xa0, 0xa0, 0xa0, 0xff},
+}
+
+// ThingCategory is the kind of object a Doom thing type is, for drawing and sorting things
+type ThingCategory int
+
+const (
+	ThingOther ThingCategory = iota // Teleport destinations, spawn spots and unknown types
+	ThingPlayer
+	ThingMonster
+	ThingWeapon
+	ThingAmmo
+	ThingPowerup // Health, armor and powerups
+	ThingKey
+	ThingDecoration
+)
+
+// Category returns the category of the thing's type, using Doom and Doom II type numbers
+func (t *Thing) Category() ThingCategory {
+	switch t.Type {
+	case 1, 2, 3, 4, 11:
+		return ThingPlayer
+	case 7, 9, 16, 58, 64, 65, 66, 67, 68, 69, 71, 72, 84, 88, 888, 3001, 3002, 3003, 3004, 3005,
+		3006:
+		return ThingMonster
+	case 82, 2001, 2002, 2003, 2004, 2005, 2006:
+		return ThingWeapon
+	case 8, 17, 2007, 2008, 2010, 2046, 2047, 2048, 2049:
+		return ThingAmmo
+	case 83, 2011, 2012, 2013, 2014, 2015, 2018, 2019, 2022, 2023, 2024, 2025, 2026, 2045:
+		return ThingPowerup
+	case 5, 6, 13, 38, 39, 40:
+		return ThingKey
+	case 14, 87, 89:
+		return ThingOther
+	}
+	if knownDoomThingType(t.Type) && t.Type < 5000 {
+		return ThingDecoration
+	}
+	return ThingOther
+}
+
+// renderer draws a level onto a canvas in pixel coordinates
+type renderer struct {
+	level      *Level
+	opts       RenderOptions
+	scale      float64
+	minX, maxY float64
+	width      int
+	height     int
+}
+
+// canvas is a drawing surface for a renderer
+type canvas interface {
+	polygon(points []Vertex, c color.RGBA)
+	line(a, b Vertex, c color.RGBA)
+	mark(p Vertex, radius float64, c color.RGBA)
+}
+
+// newRenderer fits the level to the options
+func newRenderer(l *Level, opts RenderOptions) (*renderer, error) {
+	bbox := newBBox()
+	for i := range l.Lines {
+		if line := &l.Lines[i]; l.validVertexes(line) {
+			bbox.add(l.Vertexes[line.V1Num])
+			bbox.add(l.Vertexes[line.V2Num])
+		}
+	}
+	if bbox.Left > bbox.Right {
+		return nil, errors.New("no lines to render")
+	}
+	w, h := max(bbox.Right-bbox.Left, 1), max(bbox.Top-bbox.Bottom, 1)
+	margin := float64(opts.Margin)
+
+	r := &renderer{level: l, opts: opts, scale: opts.Scale, minX: bbox.Left, maxY: bbox.Top}
+	if r.scale > 0 {
+		width, height := math.Ceil(w*r.scale+2*margin), math.Ceil(h*r.scale+2*margin)
+		if width*height > MaxRenderPixels {
+			return nil, fmt.Errorf("scale %v gives an image of %vx%v pixels, more than %v",
+				r.scale, width, height, MaxRenderPixels)
+		}
+		r.width, r.height = int(width), int(height)
+	} else {
+		r.width, r.height = opts.Width, opts.Height
+		if r.width <= 0 {
+			r.width = 1024
+		}
+		if r.height <= 0 {
+			r.height = 1024
+		}
+		if float64(r.width)*float64(r.height) > MaxRenderPixels {
+			return nil, fmt.Errorf("image of %vx%v pixels is more than %v", r.width, r.height,
+				MaxRenderPixels)
+		}
+		r.scale = min((float64(r.width)-2*margin)/w, (float64(r.height)-2*margin)/h)
+		if r.scale <= 0 {
+			return nil, fmt.Errorf("margin %v leaves no room in %vx%v", opts.Margin, r.width,
+				r.height)
+		}
+
+		// Center the map
+		r.minX -= (float64(r.width) - 2*margin - w*r.scale) / 2 / r.scale
+		r.maxY += (float64(r.height) - 2*margin - h*r.scale) / 2 / r.scale
+	}
+	return r, nil
+}
+
+// point converts map coordinates to pixel coordinates, with Y down
+func (r *renderer) point(x, y float64) Vertex {
+	margin := float64(r.opts.Margin)
+	return Vertex{X: (x-r.minX)*r.scale + margin, Y: (r.maxY-y)*r.scale + margin}
+}
+
+// draw draws the level: sector fills, then the block map grid, lines, partition lines and things
+func (r *renderer) draw(c canvas) {
+	l := r.level
+	if r.opts.SectorFills && r.opts.Palette != nil {
+		colors := map[*Flat]color.RGBA{}
+		for _, s := range l.SubSectors {
+			if s.Sector == nil || s.Sector.FloorTexture == nil || len(s.Polygon) < 3 {
+				continue
+			}
+			fill, ok := colors[s.Sector.FloorTexture]
+			if !ok {
+				fill = flatColor(s.Sector.FloorTexture, r.opts.Palette)
+				colors[s.Sector.FloorTexture] = fill
+			}
+			points := make([]Vertex, len(s.Polygon))
+			for i, v := range s.Polygon {
+				points[i] = r.point(v.X, v.Y)
+			}
+			c.polygon(points, fill)
+		}
+	}
+
+	if b := &l.BlockMap; r.opts.BlockMap && b.NumColumns > 0 && b.NumRows > 0 {
+		right := b.OriginX + float64(b.NumColumns*BlockSize)
+		top := b.OriginY + float64(b.NumRows*BlockSize)
+		for i := range b.NumColumns + 1 {
+			x := b.OriginX + float64(i*BlockSize)
+			c.line(r.point(x, b.OriginY), r.point(x, top), renderGrid)
+		}
+		for i := range b.NumRows + 1 {
+			y := b.OriginY + float64(i*BlockSize)
+			c.line(r.point(b.OriginX, y), r.point(right, y), renderGrid)
+		}
+	}
+
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		if !l.validVertexes(line) {
+			continue
+		}
+		v1, v2 := l.Vertexes[line.V1Num], l.Vertexes[line.V2Num]
+		c.line(r.point(v1.X, v1.Y), r.point(v2.X, v2.Y), r.lineColor(line))
+	}
+
+	if r.opts.Nodes {
+		for _, n := range l.Nodes {
+			if a, b, ok := partitionInBox(&n); ok {
+				c.line(r.point(a.X, a.Y), r.point(b.X, b.Y), renderPartition)
+			}
+		}
+	}
+
+	if r.opts.Things {
+		radius := max(16*r.scale, 1.5)
+		for i := range l.Things {
+			t := &l.Things[i]
+			c.mark(r.point(float64(t.X), float64(t.Y)), radius, renderThingColors[t.Category()])
+		}
+	}
+}
+
+// lineColor returns the automap color of a line
+func (r *renderer) lineColor(line *Line) color.RGBA {
+	sector := func(side int) *Sector {
+		if side < 0 || side >= len(r.level.Sides) {
+			return nil
+		}
+		n := r.level.Sides[side].SectorNum
+		if n < 0 || n >= len(r.level.Sectors) {
+			return nil
+		}
+		return &r.level.Sectors[n]
+	}
+	front, back := sector(line.SideRNum), sector(line.SideLNum)
+	switch {
+	case line.NeverMap:
+		return renderNeverMap
+	case line.Secret:
+		return renderSecret
+	case front == nil || back == nil:
+		return renderWall
+	case front.FloorHeight != back.FloorHeight:
+		return renderFloorChange
+	case front.CeilingHeight != back.CeilingHeight:
+		return renderCeilingChange
+	}
+	return renderNoChange
+}
+
+// partitionInBox returns the part of a node's partition line inside the union of its child
+// bounding boxes, or false if it misses them
+func partitionInBox(n *Node) (Vertex, Vertex, bool) {
+	left, right := min(n.BBoxR.Left, n.BBoxL.Left), max(n.BBoxR.Right, n.BBoxL.Right)
+	bottom, top := min(n.BBoxR.Bottom, n.BBoxL.Bottom), max(n.BBoxR.Top, n.BBoxL.Top)
+	if n.DX == 0 && n.DY == 0 {
+		return Vertex{}, Vertex{}, false
+	}
+
+	// Clip the infinite line p + t*d to the box, Liang-Barsky style
+	tMin, tMax := math.Inf(-1), math.Inf(1)
+	for _, s := range [2]struct{ p, d, lo, hi float64 }{
+		{n.X, n.DX, left, right}, {n.Y, n.DY, bottom, top},
+	} {
+		if s.d == 0 {
+			if s.p < s.lo || s.p > s.hi {
+				return Vertex{}, Vertex{}, false
+			}
+			continue
+		}
+		t1, t2 := (s.lo-s.p)/s.d, (s.hi-s.p)/s.d
+		tMin, tMax = max(tMin, min(t1, t2)), min(tMax, max(t1, t2))
+	}
+	if tMin > tMax {
+		return Vertex{}, Vertex{}, false
+	}
+	return Vertex{X: n.X + tMin*n.DX, Y: n.Y + tMin*n.DY},
+		Vertex{X: n.X + tMax*n.DX, Y: n.Y + tMax*n.DY}, true
+}
+
+// flatColor returns the average color of a flat
+func flatColor(f *Flat, pal *Palette) color.RGBA {
+	var r, g, b int
+	for _, index := range f.Data {
+		r += int(pal[index].Red)
+		g += int(pal[index].Green)
+		b += int(pal[index].Blue)
+	}
+	n := max(len(f.Data), 1)
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff}
+}
+
+// RenderSVG draws the level as an SVG image in the automap color scheme: red one-sided lines,
+// brown and yellow two-sided lines with floor and ceiling height changes, gray two-sided lines
+// with no change, magenta secret lines and dark gray lines that are never shown on the map.
+func (l *Level) RenderSVG(w io.Writer, opts RenderOptions) error {
+	r, err := newRenderer(l, opts)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+		`viewBox="0 0 %d %d">`+"\n", r.width, r.height, r.width, r.height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%v"/>`+"\n", svgColor(renderBackground))
+	r.draw(&svgCanvas{bw})
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// svgCanvas writes SVG elements
+type svgCanvas struct {
+	w *bufio.Writer
+}
+
+func (s *svgCanvas) polygon(points []Vertex, c color.RGBA) {
+	fmt.Fprint(s.w, `<polygon points="`)
+	for i, p := range points {
+		if i > 0 {
+			fmt.Fprint(s.w, " ")
+		}
+		fmt.Fprintf(s.w, "%.2f,%.2f", p.X, p.Y)
+	}
+	// A stroke of the fill color hides the seams between neighbouring polygons
+	fmt.Fprintf(s.w, `" fill="%v" stroke="%[1]v" stroke-width="0.5"/>`+"\n", svgColor(c))
+}
+
+func (s *svgCanvas) line(a, b Vertex, c color.RGBA) {
+	fmt.Fprintf(s.w, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="%v"/>`+"\n", a.X,
+		a.Y, b.X, b.Y, svgColor(c))
+}
+
+func (s *svgCanvas) mark(p Vertex, radius float64, c color.RGBA) {
+	fmt.Fprintf(s.w, `<circle cx="%.2f" cy="%.2f" r="%.2f" fill="%v"/>`+"\n", p.X, p.Y, radius,
+		svgColor(c))
+}
+
+// svgColor formats a color as #rrggbb
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// RenderImage draws the level as an image, as for RenderSVG
+func (l *Level) RenderImage(opts RenderOptions) (*image.RGBA, error) {
+	r, err := newRenderer(l, opts)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = renderBackground.R,
+			renderBackground.G, renderBackground.B, renderBackground.A
+	}
+	r.draw(&imageCanvas{img})
+	return img, nil
+}
+
+// RenderPNG draws the level as a PNG image, as for RenderSVG
+func (l *Level) RenderPNG(w io.Writer, opts RenderOptions) error {
+	img, err := l.RenderImage(opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// imageCanvas draws onto an RGBA image
+type imageCanvas struct {
+	img *image.RGBA
+}
+
+// polygon fills a convex polygon, covering the pixels whose centers are inside it
+func (ic *imageCanvas) polygon(points []Vertex, c color.RGBA) {
+	bounds := ic.img.Bounds()
+	top, bottom := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		top, bottom = min(top, p.Y), max(bottom, p.Y)
+	}
+	for y := max(int(math.Ceil(top-0.5)), bounds.Min.Y); y < min(int(math.Ceil(bottom-0.5)),
+		bounds.Max.Y); y++ {
+		cy := float64(y) + 0.5
+		left, right := math.Inf(1), math.Inf(-1)
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			if (a.Y <= cy) == (b.Y <= cy) {
+				continue
+			}
+			x := a.X + (cy-a.Y)/(b.Y-a.Y)*(b.X-a.X)
+			left, right = min(left, x), max(right, x)
+		}
+		for x := max(int(math.Ceil(left-0.5)), bounds.Min.X); x < min(int(math.Ceil(right-0.5)),
+			bounds.Max.X); x++ {
+			ic.img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// line draws a one pixel line with Bresenham's algorithm
+func (ic *imageCanvas) line(a, b Vertex, c color.RGBA) {
+	x0, y0 := int(math.Floor(a.X)), int(math.Floor(a.Y))
+	x1, y1 := int(math.Floor(b.X)), int(math.Floor(b.Y))
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		ic.img.SetRGBA(x0, y0, c) // Ignores points outside the image
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// mark draws a filled circle
+func (ic *imageCanvas) mark(p Vertex, radius float64, c color.RGBA) {
+	for y := int(math.Floor(p.Y - radius)); y <= int(math.Ceil(p.Y+radius)); y++ {
+		for x := int(math.Floor(p.X - radius)); x <= int(math.Ceil(p.X+radius)); x++ {
+			if math.Hypot(float64(x)+0.5-p.X, float64(y)+0.5-p.Y) <= radius {
+				ic.img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
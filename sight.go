@@ -0,0 +1,215 @@
+package wad
+
+import "math"
+
+// sightTrace is the state of a line of sight check, as kept in globals by Doom's p_sight.c
+type sightTrace struct {
+	level                 *Level
+	x, y, dx, dy          float64 // The line of sight, from the start to the end
+	startZ                float64
+	topSlope, bottomSlope float64 // Heights at the end of the line of sight still visible
+	endX, endY            float64
+	checked               []bool // Lines already checked, by number
+}
+
+// CheckSight reports whether a thing of height toHeight standing at the point to can be seen by
+// one of height fromHeight at the point from, as Doom's P_CheckSight decides whether monsters see
+// each other. The eye is three quarters of the way up the viewer, and sight reaches the target if
+// any of its own height, from to.Z to to.Z+toHeight, is visible. Sight is blocked if the reject
+// table rejects the sectors of the points, or if every line from the eye to the target crosses a
+// one-sided line or passes above or below the opening of a two-sided line, found by tracing it
+// through the BSP tree. Sides are found as for SubSectorAt.
+func (l *Level) CheckSight(from, to Point, fromHeight, toHeight float64) bool {
+	s1, s2 := l.SectorAt(from.X, from.Y), l.SectorAt(to.X, to.Y)
+	if s1 == nil || s2 == nil {
+		return false
+	}
+	if s1.Index < len(l.Reject) && s2.Index < len(l.Reject[s1.Index]) &&
+		l.Reject[s1.Index][s2.Index] {
+		return false
+	}
+	if from.X == to.X && from.Y == to.Y {
+		return true
+	}
+
+	startZ := from.Z + fromHeight - fromHeight/4
+	t := &sightTrace{
+		level:       l,
+		x:           from.X,
+		y:           from.Y,
+		dx:          to.X - from.X,
+		dy:          to.Y - from.Y,
+		startZ:      startZ,
+		topSlope:    to.Z + toHeight - startZ,
+		bottomSlope: to.Z - startZ,
+		endX:        to.X,
+		endY:        to.Y,
+		checked:     make([]bool, len(l.Lines)),
+	}
+	if len(l.Nodes) == 0 {
+		return t.crossSubSector(&l.SubSectors[0])
+	}
+	return t.crossNode(len(l.Nodes)-1, 0)
+}
+
+// crossNode returns false if sight is blocked in the branch of the tree with a child number,
+// looking first on the side of the node the line of sight starts on, as P_CrossBSPNode does
+func (t *sightTrace) crossNode(child, depth int) bool {
+	l := t.level
+	if child < 0 {
+		if child&math.MaxInt32 >= len(l.SubSectors) {
+			return true
+		}
+		return t.crossSubSector(&l.SubSectors[child&math.MaxInt32])
+	}
+	if child >= len(l.Nodes) || depth > len(l.Nodes) { // Guards against broken trees with cycles
+		return true
+	}
+
+	n := &l.Nodes[child]
+	side := l.divlineSide(t.x, t.y, n.X, n.Y, n.DX, n.DY)
+	if side == 2 {
+		side = 0 // A start on the partition line crosses both sides
+	}
+	children := [2]int{n.ChildNumR, n.ChildNumL}
+	if !t.crossNode(children[side], depth+1) {
+		return false
+	}
+	if side == l.divlineSide(t.endX, t.endY, n.X, n.Y, n.DX, n.DY) {
+		return true // The line of sight doesn't reach the other side
+	}
+	return t.crossNode(children[side^1], depth+1)
+}
+
+// crossSubSector returns false if sight is blocked by a line of a subsector's segs, narrowing the
+// slopes through each opening crossed as P_CrossSubsector does
+func (t *sightTrace) crossSubSector(s *SubSector) bool {
+	l := t.level
+	for i := range s.LineSegments {
+		seg := &s.LineSegments[i]
+		line := seg.Line
+		if line == nil || t.checked[seg.LineNum] {
+			continue
+		}
+		t.checked[seg.LineNum] = true
+
+		// The line must cross the line of sight, and the line of sight must cross the line
+		v1, v2 := line.V1, line.V2
+		if l.divlineSide(v1.X, v1.Y, t.x, t.y, t.dx, t.dy) ==
+			l.divlineSide(v2.X, v2.Y, t.x, t.y, t.dx, t.dy) {
+			continue
+		}
+		dx, dy := v2.X-v1.X, v2.Y-v1.Y
+		if l.divlineSide(t.x, t.y, v1.X, v1.Y, dx, dy) ==
+			l.divlineSide(t.endX, t.endY, v1.X, v1.Y, dx, dy) {
+			continue
+		}
+
+		front, back := seg.FrontSector, seg.BackSector
+		if !line.TwoSided || front == nil || back == nil {
+			return false
+		}
+		if front.FloorHeight == back.FloorHeight && front.CeilingHeight == back.CeilingHeight {
+			continue
+		}
+		openTop := min(front.CeilingHeight, back.CeilingHeight)
+		openBottom := max(front.FloorHeight, back.FloorHeight)
+		if openBottom >= openTop {
+			return false // A closed door
+		}
+
+		// Slopes are heights at the end of the line of sight, so divide by the fraction along it.
+		// An opening at the eye still narrows them, as vanilla's FixedDiv saturates there.
+		frac := max(intercept(t.x, t.y, t.dx, t.dy, v1.X, v1.Y, dx, dy), fixedToFloat(1))
+		if front.FloorHeight != back.FloorHeight {
+			t.bottomSlope = max(t.bottomSlope, (openBottom-t.startZ)/frac)
+		}
+		if front.CeilingHeight != back.CeilingHeight {
+			t.topSlope = min(t.topSlope, (openTop-t.startZ)/frac)
+		}
+		if t.topSlope <= t.bottomSlope {
+			return false
+		}
+	}
+	return true
+}
+
+// intercept returns the fraction along the line from tx, ty in direction tdx, tdy at which it
+// crosses the line through x, y in direction dx, dy, as P_InterceptVector does, or zero if they
+// are parallel
+func intercept(tx, ty, tdx, tdy, x, y, dx, dy float64) float64 {
+	den := dy*tdx - dx*tdy
+	if den == 0 {
+		return 0
+	}
+	return ((x-tx)*dy + (ty-y)*dx) / den
+}
+
+// divlineSide returns the side of the line through x1, y1 in direction dx, dy that a point is on,
+// as P_DivlineSide does: 0 for the right, or front, 1 for the left, or back, and 2 for on the line.
+// Sides are found in fixed point if the level's FixedPoint is set.
+func (l *Level) divlineSide(x, y, x1, y1, dx, dy float64) int {
+	if l.FixedPoint {
+		return divlineSideFixed(floatToFixed(x), floatToFixed(y), floatToFixed(x1),
+			floatToFixed(y1), floatToFixed(dx), floatToFixed(dy))
+	}
+	if dx == 0 {
+		if x == x1 {
+			return 2
+		}
+		if x <= x1 {
+			return boolToSide(dy > 0)
+		}
+		return boolToSide(dy < 0)
+	}
+	if dy == 0 {
+		if y == y1 {
+			return 2
+		}
+		if y <= y1 {
+			return boolToSide(dx < 0)
+		}
+		return boolToSide(dx > 0)
+	}
+	left, right := dy*(x-x1), (y-y1)*dx
+	switch {
+	case right < left:
+		return 0
+	case right == left:
+		return 2
+	}
+	return 1
+}
+
+// divlineSideFixed is divlineSide computed exactly as vanilla Doom computes it, down to comparing
+// x with the line's y for horizontal lines, and truncating coordinates to whole units
+func divlineSideFixed(x, y, x1, y1, dx, dy int32) int {
+	if dx == 0 {
+		if x == x1 {
+			return 2
+		}
+		if x <= x1 {
+			return boolToSide(dy > 0)
+		}
+		return boolToSide(dy < 0)
+	}
+	if dy == 0 {
+		if x == y1 {
+			return 2
+		}
+		if y <= y1 {
+			return boolToSide(dx < 0)
+		}
+		return boolToSide(dx > 0)
+	}
+	ox, oy := x-x1, y-y1 // Wraps on overflow, as in C
+	left := (dy >> 16) * (ox >> 16)
+	right := (oy >> 16) * (dx >> 16)
+	switch {
+	case right < left:
+		return 0
+	case right == left:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,123 @@
+package wad
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// DMX sounds have this many padding bytes before and after the samples, included in the header's
+// sample count
+const dmxPadding = 16
+
+// DefaultSampleRate is used for sounds whose header gives no sample rate
+const DefaultSampleRate = 11025
+
+// decodeSound decodes a DMX format sound lump. Returns nil if the lump is in another format.
+func decodeSound(lump []byte) (*Sound, error) {
+
+	// Read header
+	var header binSoundHeader
+	if err := binary.Read(bytes.NewReader(lump), binary.LittleEndian, &header); err != nil {
+		return nil, errors.New("dmx: header truncated")
+	}
+	if header.Format != 3 {
+		return nil, nil
+	}
+	sampleRate := uint(header.SampleRate)
+	if sampleRate == 0 {
+		sampleRate = DefaultSampleRate
+	}
+
+	// Some lumps are shorter than their header claims, so trust the lump size. Counts too small
+	// to hold the padding are taken to be unpadded.
+	data := lump[unsafe.Sizeof(header):]
+	data = data[:min(uint64(header.Bytes), uint64(len(data)))]
+	if len(data) >= 2*dmxPadding {
+		data = data[dmxPadding : len(data)-dmxPadding]
+	}
+	samples := make([]byte, len(data))
+	copy(samples, data)
+	return &Sound{
+		SampleRate: sampleRate,
+		Samples:    samples,
+	}, nil
+}
+
+// Duration returns the playing time of the sound
+func (s *Sound) Duration() time.Duration {
+	if s.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(len(s.Samples)) * time.Second / time.Duration(s.SampleRate)
+}
+
+// PCM16 returns the samples converted to signed 16-bit PCM
+func (s *Sound) PCM16() []int16 {
+	pcm := make([]int16, len(s.Samples))
+	for i, b := range s.Samples {
+		pcm[i] = (int16(b) - 128) << 8
+	}
+	return pcm
+}
+
+// Float32 returns the samples converted to floating point PCM in the range [-1, 1)
+func (s *Sound) Float32() []float32 {
+	pcm := make([]float32, len(s.Samples))
+	for i, b := range s.Samples {
+		pcm[i] = float32(int(b)-128) / 128
+	}
+	return pcm
+}
+
+// WriteWAV writes the sound as an 8-bit unsigned mono PCM WAV file
+func (s *Sound) WriteWAV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	dataSize := uint32(len(s.Samples))
+	padded := dataSize + dataSize%2 // Chunks are word aligned
+	header := struct {
+		RiffID        [4]byte
+		RiffSize      uint32
+		WaveID        [4]byte
+		FmtID         [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		DataID        [4]byte
+		DataSize      uint32
+	}{
+		RiffID:        [4]byte{'R', 'I', 'F', 'F'},
+		RiffSize:      36 + padded,
+		WaveID:        [4]byte{'W', 'A', 'V', 'E'},
+		FmtID:         [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		NumChannels:   1,
+		SampleRate:    uint32(s.SampleRate),
+		ByteRate:      uint32(s.SampleRate),
+		BlockAlign:    1,
+		BitsPerSample: 8,
+		DataID:        [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	if _, err := bw.Write(s.Samples); err != nil {
+		return err
+	}
+	if padded != dataSize {
+		if err := bw.WriteByte(0); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,32 @@
+package wad
+
+// Radius returns the radius of the thing's type in map units, using Doom and Doom II type numbers.
+// Types without a radius of their own get 20, the radius of most items.
+func (t *Thing) Radius() float64 {
+	switch t.Type {
+	case 1, 2, 3, 4, 11, 72, 88, 3006:
+		return 16
+	case 888:
+		return 12
+	case 2035:
+		return 10
+	case 58, 3002:
+		return 30
+	case 71, 3005:
+		return 31
+	case 69, 3003:
+		return 24
+	case 16:
+		return 40
+	case 67:
+		return 48
+	case 68:
+		return 64
+	case 7:
+		return 128
+	}
+	if t.Category() == ThingDecoration {
+		return 16
+	}
+	return 20
+}
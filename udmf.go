@@ -0,0 +1,432 @@
+package wad
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A UDMF map's TEXTMAP lump is text made of global assignments, such as the namespace, and blocks
+// of assignments, one for each thing, vertex, linedef, sidedef and sector. The format is
+// documented at https://github.com/ZDoom/gzdoom/blob/master/specs/udmf.txt
+
+// udmfBlock is a block of a TEXTMAP, such as a thing or linedef. Field names are lower case, and
+// values are int, float64, string or bool.
+type udmfBlock struct {
+	kind   string
+	fields map[string]any
+}
+
+// udmfToken is a token of a TEXTMAP. Punctuation is a token of its own text.
+type udmfToken struct {
+	kind  udmfTokenKind
+	text  string
+	value any
+	line  int
+}
+
+type udmfTokenKind int
+
+const (
+	udmfEOF udmfTokenKind = iota
+	udmfIdentifier
+	udmfValue // An integer, float or quoted string
+	udmfPunct
+)
+
+// udmfLexer splits a TEXTMAP into tokens, skipping white space and comments
+type udmfLexer struct {
+	data []byte
+	pos  int
+	line int
+}
+
+// next returns the next token
+func (lx *udmfLexer) next() (udmfToken, error) {
+	if err := lx.skipSpace(); err != nil {
+		return udmfToken{}, err
+	}
+	if lx.pos >= len(lx.data) {
+		return udmfToken{kind: udmfEOF, line: lx.line}, nil
+	}
+	start, c := lx.pos, lx.data[lx.pos]
+	switch {
+	case c == '{' || c == '}' || c == '=' || c == ';':
+		lx.pos++
+		return udmfToken{kind: udmfPunct, text: string(c), line: lx.line}, nil
+	case c == '"':
+		return lx.quoted()
+	case isUDMFIdentStart(c):
+		for lx.pos < len(lx.data) && isUDMFIdent(lx.data[lx.pos]) {
+			lx.pos++
+		}
+		return udmfToken{kind: udmfIdentifier, text: string(lx.data[start:lx.pos]), line: lx.line}, nil
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		return lx.number()
+	}
+	return udmfToken{}, fmt.Errorf("udmf: line %v: unexpected %q", lx.line, c)
+}
+
+// skipSpace skips white space, line comments and block comments
+func (lx *udmfLexer) skipSpace() error {
+	for lx.pos < len(lx.data) {
+		switch c := lx.data[lx.pos]; {
+		case c == '\n':
+			lx.line++
+			lx.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			lx.pos++
+		case c == '/' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '/':
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' {
+				lx.pos++
+			}
+		case c == '/' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '*':
+			end := strings.Index(string(lx.data[lx.pos+2:]), "*/")
+			if end < 0 {
+				return fmt.Errorf("udmf: line %v: unterminated comment", lx.line)
+			}
+			comment := lx.data[lx.pos : lx.pos+2+end+2]
+			lx.line += strings.Count(string(comment), "\n")
+			lx.pos += len(comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// quoted reads a quoted string, in which a backslash escapes the following character
+func (lx *udmfLexer) quoted() (udmfToken, error) {
+	line := lx.line
+	var sb strings.Builder
+	for lx.pos++; lx.pos < len(lx.data); lx.pos++ {
+		c := lx.data[lx.pos]
+		switch {
+		case c == '"':
+			lx.pos++
+			return udmfToken{kind: udmfValue, value: sb.String(), line: line}, nil
+		case c == '\\' && lx.pos+1 < len(lx.data):
+			lx.pos++
+			c = lx.data[lx.pos]
+		case c == '\n':
+			lx.line++
+		}
+		sb.WriteByte(c)
+	}
+	return udmfToken{}, fmt.Errorf("udmf: line %v: unterminated string", line)
+}
+
+// number reads an integer, which may be hexadecimal or octal, or a float
+func (lx *udmfLexer) number() (udmfToken, error) {
+	start := lx.pos
+	lx.pos++
+	for lx.pos < len(lx.data) && isUDMFNumber(lx.data[lx.pos], lx.data[lx.pos-1]) {
+		lx.pos++
+	}
+	text := string(lx.data[start:lx.pos])
+	if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return udmfToken{kind: udmfValue, value: int(i), line: lx.line}, nil
+	}
+	if strings.ContainsAny(text, ".eE") && !strings.ContainsAny(text, "xX") {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return udmfToken{kind: udmfValue, value: f, line: lx.line}, nil
+		}
+	}
+	return udmfToken{}, fmt.Errorf("udmf: line %v: bad number %q", lx.line, text)
+}
+
+func isUDMFIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isUDMFIdent(c byte) bool {
+	return isUDMFIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// isUDMFNumber reports whether c continues a number, given the previous character
+func isUDMFNumber(c, prev byte) bool {
+	return c >= '0' && c <= '9' || c == '.' || c == 'x' || c == 'X' ||
+		c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' ||
+		(c == '+' || c == '-') && (prev == 'e' || prev == 'E')
+}
+
+// parseTextMap parses a TEXTMAP lump into its namespace and blocks
+func parseTextMap(data []byte) (string, []udmfBlock, error) {
+	lx := &udmfLexer{data: data, line: 1}
+	var namespace string
+	var blocks []udmfBlock
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return "", nil, err
+		}
+		if tok.kind == udmfEOF {
+			return namespace, blocks, nil
+		}
+		if tok.kind != udmfIdentifier {
+			return "", nil, fmt.Errorf("udmf: line %v: expected identifier", tok.line)
+		}
+		name := strings.ToLower(tok.text)
+		punct, err := lx.next()
+		if err != nil {
+			return "", nil, err
+		}
+		switch punct.text {
+		case "=":
+			value, err := lx.assignment()
+			if err != nil {
+				return "", nil, err
+			}
+			if name == "namespace" {
+				namespace, _ = value.(string)
+			}
+		case "{":
+			block := udmfBlock{kind: name, fields: map[string]any{}}
+			if err := lx.block(block.fields); err != nil {
+				return "", nil, err
+			}
+			blocks = append(blocks, block)
+		default:
+			return "", nil, fmt.Errorf("udmf: line %v: expected = or {", punct.line)
+		}
+	}
+}
+
+// block reads the assignments of a block up to its closing brace
+func (lx *udmfLexer) block(fields map[string]any) error {
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind == udmfPunct && tok.text == "}" {
+			return nil
+		}
+		if tok.kind != udmfIdentifier {
+			return fmt.Errorf("udmf: line %v: expected identifier or }", tok.line)
+		}
+		if eq, err := lx.next(); err != nil {
+			return err
+		} else if eq.text != "=" {
+			return fmt.Errorf("udmf: line %v: expected =", eq.line)
+		}
+		value, err := lx.assignment()
+		if err != nil {
+			return err
+		}
+		fields[strings.ToLower(tok.text)] = value
+	}
+}
+
+// assignment reads the value of an assignment and its terminating semicolon. The keywords true and
+// false are bools, and other bare identifiers are kept as strings.
+func (lx *udmfLexer) assignment() (any, error) {
+	tok, err := lx.next()
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch tok.kind {
+	case udmfValue:
+		value = tok.value
+	case udmfIdentifier:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		default:
+			value = tok.text
+		}
+	default:
+		return nil, fmt.Errorf("udmf: line %v: expected value", tok.line)
+	}
+	if semi, err := lx.next(); err != nil {
+		return nil, err
+	} else if semi.text != ";" {
+		return nil, fmt.Errorf("udmf: line %v: expected ;", semi.line)
+	}
+	return value, nil
+}
+
+// Field accessors, returning def if the field is missing or of the wrong type. Integers are
+// accepted where floats are expected.
+
+func (b *udmfBlock) intField(name string, def int) int {
+	if v, ok := b.fields[name].(int); ok {
+		return v
+	}
+	return def
+}
+
+func (b *udmfBlock) floatField(name string, def float64) float64 {
+	switch v := b.fields[name].(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return def
+}
+
+func (b *udmfBlock) stringField(name string, def string) string {
+	if v, ok := b.fields[name].(string); ok {
+		return v
+	}
+	return def
+}
+
+func (b *udmfBlock) boolField(name string) bool {
+	v, _ := b.fields[name].(bool)
+	return v
+}
+
+func (b *udmfBlock) args() [5]int {
+	var args [5]int
+	for i := range args {
+		args[i] = b.intField(fmt.Sprintf("arg%d", i), 0)
+	}
+	return args
+}
+
+// isDoomNamespace reports whether a UDMF namespace uses Doom style line specials, in which case
+// arg0 holds the sector tag
+func isDoomNamespace(namespace string) bool {
+	switch strings.ToLower(namespace) {
+	case "doom", "heretic", "strife":
+		return true
+	}
+	return false
+}
+
+// readTextMap reads a TEXTMAP lump into the things, vertexes, lines, sides and sectors of a level
+func (w *WAD) readTextMap(lumpInfo *LumpInfo, level *Level, sectorUser any) error {
+	logger.Println("Reading TEXTMAP ...")
+
+	lump, err := w.readLump(lumpInfo)
+	if err != nil {
+		return err
+	}
+	namespace, blocks, err := parseTextMap(lump)
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		return errors.New("udmf: missing namespace")
+	}
+	level.Namespace = namespace
+	doom := isDoomNamespace(namespace)
+
+	for i := range blocks {
+		b := &blocks[i]
+		switch b.kind {
+		case "thing":
+			level.Things = append(level.Things, Thing{
+				X:               int(b.floatField("x", 0)),
+				Y:               int(b.floatField("y", 0)),
+				Angle:           degreesToRadians(b.intField("angle", 0)),
+				Type:            b.intField("type", 0),
+				Skill1and2:      b.boolField("skill1") || b.boolField("skill2"),
+				Skill3:          b.boolField("skill3"),
+				Skill4and5:      b.boolField("skill4") || b.boolField("skill5"),
+				Ambush:          b.boolField("ambush"),
+				MultiplayerOnly: !b.boolField("single"),
+				TID:             b.intField("id", 0),
+				Z:               int(b.floatField("height", 0)),
+				Special:         b.intField("special", 0),
+				Args:            b.args(),
+				Dormant:         b.boolField("dormant"),
+				Fighter:         b.boolField("class1"),
+				Cleric:          b.boolField("class2"),
+				Mage:            b.boolField("class3"),
+				SinglePlayer:    b.boolField("single"),
+				Cooperative:     b.boolField("coop"),
+				Deathmatch:      b.boolField("dm"),
+				Fields:          b.fields,
+			})
+		case "vertex":
+			level.Vertexes = append(level.Vertexes, Vertex{
+				X:      b.floatField("x", 0),
+				Y:      b.floatField("y", 0),
+				Fields: b.fields,
+			})
+		case "linedef":
+			line := Line{
+				V1Num:                  b.intField("v1", 0),
+				V2Num:                  b.intField("v2", 0),
+				BlockPlayerAndMonsters: b.boolField("blocking"),
+				BlockMonsters:          b.boolField("blockmonsters"),
+				TwoSided:               b.boolField("twosided"),
+				UpperTextureUnpegged:   b.boolField("dontpegtop"),
+				LowerTextureUnpegged:   b.boolField("dontpegbottom"),
+				Secret:                 b.boolField("secret"),
+				BlocksSound:            b.boolField("blocksound"),
+				NeverMap:               b.boolField("dontdraw"),
+				Mapped:                 b.boolField("mapped"),
+				SideRNum:               b.intField("sidefront", -1),
+				SideLNum:               b.intField("sideback", -1),
+				Repeatable:             b.boolField("repeatspecial"),
+				Fields:                 b.fields,
+			}
+			if doom {
+				line.Type = LineType(b.intField("special", 0))
+				line.SectorTagNum = b.intField("arg0", 0)
+			} else {
+				line.Special = b.intField("special", 0)
+				line.Args = b.args()
+			}
+			switch {
+			case b.boolField("playeruse"):
+				line.Activation = ActivationUse
+			case b.boolField("monstercross"):
+				line.Activation = ActivationMonsterCross
+			case b.boolField("impact"):
+				line.Activation = ActivationImpact
+			case b.boolField("playerpush"):
+				line.Activation = ActivationPush
+			case b.boolField("missilecross"):
+				line.Activation = ActivationProjectileCross
+			}
+			level.Lines = append(level.Lines, line)
+		case "sidedef":
+			side := Side{
+				XOffset:           b.floatField("offsetx", 0),
+				YOffset:           b.floatField("offsety", 0),
+				UpperTextureName:  b.stringField("texturetop", "-"),
+				LowerTextureName:  b.stringField("texturebottom", "-"),
+				MiddleTextureName: b.stringField("texturemiddle", "-"),
+				SectorNum:         b.intField("sector", 0),
+				Fields:            b.fields,
+			}
+			side.UpperTexture = w.textureOrNil(side.UpperTextureName)
+			side.MiddleTexture = w.textureOrNil(side.MiddleTextureName)
+			side.LowerTexture = w.textureOrNil(side.LowerTextureName)
+			level.Sides = append(level.Sides, side)
+		case "sector":
+			newUser, err := cloneSectorUserData(sectorUser)
+			if err != nil {
+				return errors.New("cannot clone passed sectorUserData")
+			}
+			sector := Sector{
+				Index:              len(level.Sectors),
+				FloorHeight:        b.floatField("heightfloor", 0),
+				CeilingHeight:      b.floatField("heightceiling", 0),
+				FloorTextureName:   b.stringField("texturefloor", ""),
+				CeilingTextureName: b.stringField("textureceiling", ""),
+				LightLevel:         b.intField("lightlevel", 160),
+				Type:               SectorType(b.intField("special", 0)),
+				TagNum:             b.intField("id", 0),
+				User:               &newUser,
+				Fields:             b.fields,
+			}
+			sector.FloorTexture = w.flatOrNil(sector.FloorTextureName)
+			sector.CeilingTexture = w.flatOrNil(sector.CeilingTextureName)
+			level.Sectors = append(level.Sectors, sector)
+		}
+	}
+
+	logger.Printf("Read %v things, %v vertexes, %v lines, %v sides and %v sectors", len(level.Things),
+		len(level.Vertexes), len(level.Lines), len(level.Sides), len(level.Sectors))
+	return nil
+}
@@ -0,0 +1,445 @@
+package wad
+
+import (
+	"fmt"
+	"math"
+)
+
+// Severity is how serious a Problem is
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // The map works, but something looks wrong
+	SeverityError                   // Doom would crash or misbehave
+)
+
+// String returns the severity in lower case
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Element is the kind of level item a Problem concerns
+type Element int
+
+const (
+	ElementLevel Element = iota
+	ElementThing
+	ElementLine
+	ElementSide
+	ElementVertex
+	ElementSector
+	ElementSeg
+	ElementSubSector
+	ElementNode
+	ElementBlock
+)
+
+// String returns the element name in lower case
+func (e Element) String() string {
+	names := [...]string{"level", "thing", "line", "side", "vertex", "sector", "seg", "subsector",
+		"node", "block"}
+	if e < 0 || int(e) >= len(names) {
+		return fmt.Sprintf("Element(%d)", e)
+	}
+	return names[e]
+}
+
+// Problem is something wrong with a level found by Validate
+type Problem struct {
+	Severity Severity
+	Message  string
+	Element  Element
+	Index    int // The index of the item in the level's slice of its kind, or -1 for the level
+}
+
+// String formats a problem as, for example, "error: line 12: bad right side 400"
+func (p Problem) String() string {
+	if p.Element == ElementLevel {
+		return fmt.Sprintf("%v: %v", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%v: %v %v: %v", p.Severity, p.Element, p.Index, p.Message)
+}
+
+// Validate checks the level for broken references, missing and unknown textures, unclosed sectors,
+// zero length and overlapping lines, unknown thing types, missing player starts and line specials
+// whose tags match no sector. Textures are checked against those found when the level was read,
+// so a level built in code reports every texture as unknown. An empty result means no problems
+// were found.
+func (l *Level) Validate() []Problem {
+	v := &validator{level: l}
+	v.checkSectors()
+	v.checkSides()
+	v.checkLines()
+	v.checkSectorsClosed()
+	v.checkOverlappingLines()
+	v.checkThings()
+	v.checkTags()
+	v.checkNodes()
+	v.checkBlockMap()
+	return v.problems
+}
+
+// validator collects the problems found by Validate
+type validator struct {
+	level    *Level
+	problems []Problem
+}
+
+// add records a problem
+func (v *validator) add(severity Severity, element Element, index int, format string,
+	args ...any) {
+	v.problems = append(v.problems, Problem{severity, fmt.Sprintf(format, args...), element, index})
+}
+
+// checkSectors checks sector flats
+func (v *validator) checkSectors() {
+	l := v.level
+	if len(l.Sectors) == 0 {
+		v.add(SeverityError, ElementLevel, -1, "no sectors")
+	}
+	for i, s := range l.Sectors {
+		if s.FloorTextureName == "" || s.FloorTextureName == "-" {
+			v.add(SeverityWarning, ElementSector, i, "missing floor texture")
+		} else if s.FloorTexture == nil {
+			v.add(SeverityWarning, ElementSector, i, "unknown floor texture %v", s.FloorTextureName)
+		}
+		if s.CeilingTextureName == "" || s.CeilingTextureName == "-" {
+			v.add(SeverityWarning, ElementSector, i, "missing ceiling texture")
+		} else if s.CeilingTexture == nil {
+			v.add(SeverityWarning, ElementSector, i, "unknown ceiling texture %v",
+				s.CeilingTextureName)
+		}
+	}
+}
+
+// checkSides checks side sectors and that their textures exist
+func (v *validator) checkSides() {
+	for i, s := range v.level.Sides {
+		if s.SectorNum < 0 || s.SectorNum >= len(v.level.Sectors) {
+			v.add(SeverityError, ElementSide, i, "bad sector %v", s.SectorNum)
+		}
+		for _, t := range []struct {
+			name    string
+			texture *Texture
+		}{
+			{s.UpperTextureName, s.UpperTexture},
+			{s.MiddleTextureName, s.MiddleTexture},
+			{s.LowerTextureName, s.LowerTexture},
+		} {
+			if t.name != "" && t.name != "-" && t.texture == nil {
+				v.add(SeverityWarning, ElementSide, i, "unknown texture %v", t.name)
+			}
+		}
+	}
+}
+
+// side returns a line's side, or nil if it has none or the number is out of range
+func (v *validator) side(n int) *Side {
+	if n < 0 || n >= len(v.level.Sides) {
+		return nil
+	}
+	return &v.level.Sides[n]
+}
+
+// sector returns a side's sector, or nil if the number is out of range
+func (v *validator) sector(s *Side) *Sector {
+	if s == nil || s.SectorNum < 0 || s.SectorNum >= len(v.level.Sectors) {
+		return nil
+	}
+	return &v.level.Sectors[s.SectorNum]
+}
+
+// checkLines checks line vertexes and sides, and that the textures Doom draws are present
+func (v *validator) checkLines() {
+	l := v.level
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		if !v.level.validVertexes(line) {
+			v.add(SeverityError, ElementLine, i, "bad vertex %v or %v", line.V1Num, line.V2Num)
+		} else if v1, v2 := l.Vertexes[line.V1Num], l.Vertexes[line.V2Num]; v1.X == v2.X &&
+			v1.Y == v2.Y {
+			v.add(SeverityWarning, ElementLine, i, "zero length")
+		}
+		if line.SideRNum >= len(l.Sides) || line.SideRNum < -1 {
+			v.add(SeverityError, ElementLine, i, "bad right side %v", line.SideRNum)
+		} else if line.SideRNum == -1 {
+			v.add(SeverityError, ElementLine, i, "no right side")
+		}
+		if line.SideLNum >= len(l.Sides) || line.SideLNum < -1 {
+			v.add(SeverityError, ElementLine, i, "bad left side %v", line.SideLNum)
+		}
+
+		front, back := v.side(line.SideRNum), v.side(line.SideLNum)
+		if line.TwoSided && back == nil {
+			v.add(SeverityError, ElementLine, i, "two-sided without a left side")
+		}
+		if !line.TwoSided && back != nil {
+			v.add(SeverityWarning, ElementLine, i, "has a left side but is not two-sided")
+		}
+		if front == nil {
+			continue
+		}
+		if back == nil {
+			if front.MiddleTextureName == "" || front.MiddleTextureName == "-" {
+				v.add(SeverityWarning, ElementSide, line.SideRNum, "missing middle texture")
+			}
+			continue
+		}
+
+		// Upper and lower textures are needed where the sector behind steps down or up
+		frontSector, backSector := v.sector(front), v.sector(back)
+		if frontSector == nil || backSector == nil {
+			continue
+		}
+		for _, s := range []struct {
+			num         int
+			side        *Side
+			this, other *Sector
+		}{
+			{line.SideRNum, front, frontSector, backSector},
+			{line.SideLNum, back, backSector, frontSector},
+		} {
+			sky := s.this.CeilingTextureName == SkyFlatName &&
+				s.other.CeilingTextureName == SkyFlatName
+			if s.other.CeilingHeight < s.this.CeilingHeight && !sky &&
+				(s.side.UpperTextureName == "" || s.side.UpperTextureName == "-") {
+				v.add(SeverityWarning, ElementSide, s.num, "missing upper texture")
+			}
+			if s.other.FloorHeight > s.this.FloorHeight &&
+				(s.side.LowerTextureName == "" || s.side.LowerTextureName == "-") {
+				v.add(SeverityWarning, ElementSide, s.num, "missing lower texture")
+			}
+		}
+	}
+}
+
+// checkSectorsClosed checks that the sides facing each sector form closed loops. Walking each
+// line with the sector on its right, every vertex must be left as often as it is reached.
+func (v *validator) checkSectorsClosed() {
+	l := v.level
+	balance := make([]map[int]int, len(l.Sectors))
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		if !v.level.validVertexes(line) {
+			continue
+		}
+		if s := v.side(line.SideRNum); s != nil && v.sector(s) != nil {
+			if balance[s.SectorNum] == nil {
+				balance[s.SectorNum] = map[int]int{}
+			}
+			balance[s.SectorNum][line.V1Num]++
+			balance[s.SectorNum][line.V2Num]--
+		}
+		if s := v.side(line.SideLNum); s != nil && v.sector(s) != nil {
+			if balance[s.SectorNum] == nil {
+				balance[s.SectorNum] = map[int]int{}
+			}
+			balance[s.SectorNum][line.V2Num]++
+			balance[s.SectorNum][line.V1Num]--
+		}
+	}
+	for i, b := range balance {
+		if b == nil {
+			v.add(SeverityWarning, ElementSector, i, "no sides face the sector")
+			continue
+		}
+		open := -1
+		for vertex, n := range b {
+			if n != 0 && (open < 0 || vertex < open) {
+				open = vertex
+			}
+		}
+		if open >= 0 {
+			v.add(SeverityError, ElementSector, i, "not closed at vertex %v", open)
+		}
+	}
+}
+
+// checkOverlappingLines finds collinear lines that share part of their length. Lines are bucketed
+// into block map sized cells, so only lines near each other are compared.
+func (v *validator) checkOverlappingLines() {
+	const epsilon = 1.0 / 256
+	l := v.level
+	cells := map[[2]int][]int{}
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		if !v.level.validVertexes(line) {
+			continue
+		}
+		v1, v2 := l.Vertexes[line.V1Num], l.Vertexes[line.V2Num]
+		cell := func(f float64) int {
+			return int(math.Floor(f / BlockSize))
+		}
+		for x := cell(min(v1.X, v2.X)); x <= cell(max(v1.X, v2.X)); x++ {
+			for y := cell(min(v1.Y, v2.Y)); y <= cell(max(v1.Y, v2.Y)); y++ {
+				cells[[2]int{x, y}] = append(cells[[2]int{x, y}], i)
+			}
+		}
+	}
+
+	found := map[[2]int]bool{}
+	for _, lines := range cells {
+		for a, i := range lines {
+			for _, j := range lines[a+1:] {
+				if found[[2]int{i, j}] {
+					continue
+				}
+				p1, p2 := l.Vertexes[l.Lines[i].V1Num], l.Vertexes[l.Lines[i].V2Num]
+				q1, q2 := l.Vertexes[l.Lines[j].V1Num], l.Vertexes[l.Lines[j].V2Num]
+				dx, dy := p2.X-p1.X, p2.Y-p1.Y
+				length := math.Hypot(dx, dy)
+				if length == 0 {
+					continue
+				}
+				dist := func(q Vertex) float64 {
+					return math.Abs(dx*(q.Y-p1.Y)-dy*(q.X-p1.X)) / length
+				}
+				if dist(q1) > epsilon || dist(q2) > epsilon {
+					continue
+				}
+
+				// Collinear, so compare positions along the line
+				along := func(q Vertex) float64 {
+					return (dx*(q.X-p1.X) + dy*(q.Y-p1.Y)) / length
+				}
+				t1, t2 := along(q1), along(q2)
+				if min(max(t1, t2), length)-max(min(t1, t2), 0) > epsilon {
+					found[[2]int{i, j}] = true
+					v.add(SeverityWarning, ElementLine, j, "overlaps line %v", i)
+				}
+			}
+		}
+	}
+}
+
+// checkThings checks for player 1's start, and for Doom format things of unknown types
+func (v *validator) checkThings() {
+	l := v.level
+	start := false
+	for i, t := range l.Things {
+		if t.Type == 1 {
+			start = true
+		}
+		if l.Format == MapFormatDoom && !knownDoomThingType(t.Type) {
+			v.add(SeverityWarning, ElementThing, i, "unknown type %v", t.Type)
+		}
+	}
+	if !start {
+		v.add(SeverityError, ElementLevel, -1, "no player 1 start")
+	}
+}
+
+// knownDoomThingType reports whether a thing type is in Doom, Doom II, Boom or MBF
+func knownDoomThingType(t int) bool {
+	switch {
+	case t >= 1 && t <= 89: // Player starts, monsters, keys and decorations
+		return true
+	case t >= 2001 && t <= 2008, t >= 2010 && t <= 2015, t == 2018, t == 2019,
+		t >= 2022 && t <= 2026, t == 2028, t == 2035, t >= 2045 && t <= 2049: // Items
+		return true
+	case t >= 3001 && t <= 3006: // Monsters
+		return true
+	case t == 5001, t == 5002: // Boom point pusher and puller
+		return true
+	case t == 888: // MBF helper dog
+		return true
+	}
+	return false
+}
+
+// checkTags checks that lines whose specials act on tagged sectors have a sector with their tag
+func (v *validator) checkTags() {
+	l := v.level
+	tags := map[int]bool{}
+	for _, s := range l.Sectors {
+		tags[s.TagNum] = true
+	}
+	for i, line := range l.Lines {
+		if line.Type == LineNone || !line.Type.usesTag() {
+			continue
+		}
+		if line.SectorTagNum == 0 {
+			v.add(SeverityWarning, ElementLine, i, "special %v has no tag", int(line.Type))
+		} else if !tags[line.SectorTagNum] {
+			v.add(SeverityWarning, ElementLine, i, "no sector has tag %v", line.SectorTagNum)
+		}
+	}
+}
+
+// usesTag reports whether a known Doom or Boom generalized special acts on tagged sectors.
+// Manual door specials act on the sector behind the line, and exits and scrollers on no sector.
+func (t LineType) usesTag() bool {
+	if t.IsGeneralized() {
+		trigger, _, _ := t.genTrigger()
+		return trigger != TriggerDoor
+	}
+	info, ok := t.Info()
+	if !ok {
+		return false
+	}
+	switch {
+	case info.Trigger == TriggerDoor, info.Category == CategoryExit,
+		info.Category == CategoryScroll, info.Category == CategoryNone:
+		return false
+	}
+	return true
+}
+
+// checkNodes checks references between segs, subsectors and nodes
+func (v *validator) checkNodes() {
+	l := v.level
+	for i, s := range l.LineSegments {
+		if s.V1Num < 0 || s.V1Num >= len(l.Vertexes) || s.V2Num < 0 || s.V2Num >= len(l.Vertexes) {
+			v.add(SeverityError, ElementSeg, i, "bad vertex %v or %v", s.V1Num, s.V2Num)
+		}
+		if s.LineNum >= len(l.Lines) {
+			v.add(SeverityError, ElementSeg, i, "bad line %v", s.LineNum)
+		}
+	}
+	for i, s := range l.SubSectors {
+		switch {
+		case s.numLineSegments <= 0:
+			v.add(SeverityError, ElementSubSector, i, "no segs")
+		case s.StartLineSegment < 0 || s.StartLineSegment+s.numLineSegments > len(l.LineSegments):
+			v.add(SeverityError, ElementSubSector, i, "bad segs %v to %v", s.StartLineSegment,
+				s.StartLineSegment+s.numLineSegments-1)
+		}
+	}
+	for i, n := range l.Nodes {
+		for _, c := range []int{n.ChildNumR, n.ChildNumL} {
+			switch {
+			case c < 0 && c&math.MaxInt32 >= len(l.SubSectors):
+				v.add(SeverityError, ElementNode, i, "bad child subsector %v", c&math.MaxInt32)
+			case c >= len(l.Nodes):
+				v.add(SeverityError, ElementNode, i, "bad child node %v", c)
+			case c >= i:
+				v.add(SeverityError, ElementNode, i, "child node %v is not below it in the tree", c)
+			}
+		}
+	}
+	switch {
+	case len(l.SubSectors) == 0:
+		v.add(SeverityError, ElementLevel, -1, "no subsectors")
+	case len(l.Nodes) == 0 && len(l.SubSectors) > 1:
+		v.add(SeverityError, ElementLevel, -1, "no nodes")
+	}
+}
+
+// checkBlockMap checks the block map's size and line numbers
+func (v *validator) checkBlockMap() {
+	b := &v.level.BlockMap
+	if len(b.Blocks) != b.NumColumns*b.NumRows {
+		v.add(SeverityError, ElementLevel, -1, "block map has %v blocks, but is %v by %v",
+			len(b.Blocks), b.NumColumns, b.NumRows)
+	}
+	for i, block := range b.Blocks {
+		for _, n := range block.LineNums {
+			if n >= len(v.level.Lines) {
+				v.add(SeverityError, ElementBlock, i, "bad line %v", n)
+			}
+		}
+	}
+}
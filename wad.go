@@ -10,11 +10,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
-	"os"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"golang.org/x/exp/constraints"
@@ -22,11 +24,21 @@ import (
 
 // WAD is a struct that represents Doom's data archive that contains graphics, sounds, and level
 // data. The data is organized as named lumps.
+// When loaded lazily, the resource maps are filled in as resources are first accessed through
+// Texture, Flat, Sprite, Sound and Score, and TexturesList and FlatsList are left nil.
+// A WAD is safe for concurrent use by multiple goroutines through its methods. When loaded lazily,
+// concurrent users should use the accessor methods rather than reading the resource maps.
 type WAD struct {
-	header       *Header
-	file         *os.File
+	mu           sync.RWMutex // Guards the resource maps
+	options      Options
+	archives     []*archive
 	lumpInfos    []LumpInfo
 	lumpNums     map[string]int
+	textureDefs  []textureDef
+	textureNums  map[string]int // Texture name to index into textureDefs
+	flatLumps    []int          // Lump numbers of the flats, in flat index order
+	flatNums     map[string]int // Flat name to flat index
+	spriteLumps  map[string][]int
 	Palettes     *Palettes
 	ColorMaps    *ColorMaps
 	Endoom       *Endoom
@@ -46,6 +58,18 @@ type WAD struct {
 	TransparentIndex byte
 }
 
+// Options controls how a WAD is loaded, when passed to NewWADWithOptions or one of the other
+// WithOptions constructors
+type Options struct {
+	// Lazy defers decoding textures, flats, sprites, sounds and music until they are first
+	// accessed. By default all resources are decoded when the WAD is opened.
+	Lazy bool
+
+	// Workers is the number of goroutines used to decode textures and sprites when loading
+	// eagerly. Zero or one decodes serially.
+	Workers int
+}
+
 type binHeader struct {
 	Magic        [4]byte
 	NumLumps     int32
@@ -67,17 +91,25 @@ type LumpInfo struct {
 	Name    string
 	Filepos int
 	Size    int
+	archive *archive // Archive containing the lump
 }
 
 // Sound lumps in the WAD file are stored in the DMX format; which consists of a short header
 // followed by raw 8-bit, monaural (PCM) unsigned data, typically at a sampling rate of 11025 Hz,
 // although some sounds use 22050 Hz. Each sample is one byte (8 bits).
+// Samples excludes the padding that surrounds the samples in the lump.
 type Sound struct {
 	SampleRate uint
 	Samples    []byte
 }
 
+// Music lumps (D_*) are stored in the MUS format, a compact MIDI-like event stream played at
+// 140 ticks per second.
 type MusicScore struct {
+	PrimaryChannels   int   // Count of primary channels, numbered from 0
+	SecondaryChannels int   // Count of secondary channels, numbered from 10
+	Instruments       []int // Instrument patches used by the score; 135 and up are percussion
+	Events            []SoundEvent
 }
 
 type binSide struct {
@@ -100,11 +132,13 @@ type Side struct {
 	LowerTexture      *Texture
 	MiddleTexture     *Texture
 	Sector            *Sector
+	Fields            map[string]any // All fields of a UDMF map's sidedef, keyed by lower case name
 }
 
 // Represents a Vertex. Positive X is east. Positive Y is north.
 type Vertex struct {
-	X, Y float64
+	X, Y   float64
+	Fields map[string]any // All fields of a UDMF map's vertex, keyed by lower case name
 }
 
 type binLineSegment struct {
@@ -117,12 +151,13 @@ type binLineSegment struct {
 }
 
 type LineSegment struct {
-	V1Num   int
-	V2Num   int
-	Angle   float64 // Radians
-	LineNum int
-	IsSideL bool    // false - same as linedef, true - opposite to linedef
-	Offset  float64 // Distance along line to start of segment
+	V1Num      int
+	V2Num      int
+	Angle      float64 // Radians
+	LineNum    int     // -1 for a GL node miniseg, which lies along no line
+	IsSideL    bool    // false - same as linedef, true - opposite to linedef
+	Offset     float64 // Distance along line to start of segment
+	PartnerNum int     // The GL node seg on the other side of the line or miniseg, or -1
 
 	V1          Vertex
 	V2          Vertex
@@ -143,6 +178,7 @@ type SubSector struct {
 
 	LineSegments []LineSegment
 	Sector       *Sector
+	Polygon      []Vertex // The convex area of the subsector, clockwise like its segs
 }
 
 type BoundBox struct {
@@ -164,7 +200,7 @@ type Node struct {
 	X, Y                 float64
 	DX, DY               float64
 	BBoxR, BBoxL         BoundBox
-	ChildNumR, ChildNumL int
+	ChildNumR, ChildNumL int // A node index, or a subsector index ORed with math.MinInt32
 	ChildR, ChildL       BSPMember
 	// Node                 [2]*Node
 	// SubSector            [2]*SubSector
@@ -233,7 +269,8 @@ type Sector struct {
 	SoundOrigin    Point    // origin for any sounds played by the sector
 	BlockBox       BlockBox // mapblock bounding box for height changes
 
-	User any // User data (Doom will store fields as below)
+	User   any            // User data (Doom will store fields as below)
+	Fields map[string]any // All fields of a UDMF map's sector, keyed by lower case name
 	// Soundtraversed int      // 0 = untraversed, 1,2 = sndlines -1
 	// Soundtarget    *Mobj    // thing that made a sound (or null)
 	// Validcount     int      // if == validcount, already checked
@@ -272,6 +309,8 @@ type Playpal struct {
 	Palettes [14]Palette
 }
 
+// Reject is the level's sector visibility table. Reject[i][j] is true if sector j cannot be seen
+// from sector i, letting Doom skip line of sight checks between them.
 type Reject [][]bool
 
 type binBlockMapHeader struct {
@@ -320,7 +359,13 @@ type binMusicInstruments []uint16
 type SoundEvent struct {
 	ChannelNum int
 	EventType  SoundEventType
-	Last       bool // if set, the event is followed by time information
+	Last       bool          // if set, the event is followed by time information
+	Delay      int           // Ticks to wait after the event. Zero unless Last is set
+	Note       int           // ReleaseNote and PlayNote: note number, 0-127
+	Velocity   int           // PlayNote: volume, 0-127. Repeats the channel's last volume if not given
+	PitchBend  int           // PitchWheel: 0-255, where 128 is centered and 64 and 192 are a tone down and up
+	Controller MusController // SystemEvent and ChangeController
+	Value      int           // ChangeController: controller value, 0-127
 }
 
 type SoundEventType int
@@ -331,11 +376,33 @@ const (
 	PitchWheel  // Bender
 	SystemEvent // valueless controller
 	ChangeController
-	Unknown1
+	Unknown1 // End of measure
 	ScoreEnd
 	Unknown2
 )
 
+// MUS controllers. ChangeController events use 0-9, and SystemEvent events use 10-14.
+type MusController int
+
+const (
+	MusInstrument MusController = iota // Program change
+	MusBankSelect
+	MusModulation
+	MusVolume
+	MusPan
+	MusExpression
+	MusReverbDepth
+	MusChorusDepth
+	MusSustainPedal
+	MusSoftPedal
+	MusAllSoundsOff
+	MusAllNotesOff
+	MusMono
+	MusPoly
+	MusResetAllControllers
+	MusEventType // Reserved
+)
+
 type binTextureHeader struct {
 	TextureName String8
 	Masked      int32
@@ -384,6 +451,7 @@ type Picture struct {
 	Width, Height         int
 	LeftOffset, TopOffset int // Allows soulspheres, weapons and keys to float
 	Columns               []Column
+	TransparentIndex      byte // Column value of pixels not covered by any post
 }
 
 // Rather than implement column posts, just set column to transparent and fill in post data.
@@ -392,12 +460,13 @@ type Column []byte
 // NewSize creates a new resized picture
 func (p *Picture) NewSize(width, height int) *Picture {
 	pic := Picture{
-		Name:       p.Name,
-		Width:      width,
-		Height:     height,
-		LeftOffset: p.LeftOffset,
-		TopOffset:  p.TopOffset,
-		Columns:    make([]Column, width),
+		Name:             p.Name,
+		Width:            width,
+		Height:           height,
+		LeftOffset:       p.LeftOffset,
+		TopOffset:        p.TopOffset,
+		Columns:          make([]Column, width),
+		TransparentIndex: p.TransparentIndex,
 	}
 	for y := range pic.Columns {
 		pic.Columns[y] = make(Column, height)
@@ -445,11 +514,21 @@ type SpriteFrameDir struct {
 type binSoundHeader struct {
 	Format     uint16
 	SampleRate uint16
-	Bytes      uint32
-	Pad        [16]byte
+	Bytes      uint32 // Sample count, including padding
 }
 
+// MapFormat is the binary layout of a map's lumps
+type MapFormat int
+
+const (
+	MapFormatDoom  MapFormat = iota
+	MapFormatHexen           // Things and lines carry specials with arguments, and a BEHAVIOR lump
+	MapFormatUDMF            // A TEXTMAP lump describes the map as text, up to an ENDMAP lump
+)
+
 type Level struct {
+	Format       MapFormat
+	Namespace    string // Namespace of a UDMF map, such as doom or zdoom
 	Things       []Thing
 	Lines        []Line
 	Sides        []Side
@@ -460,7 +539,20 @@ type Level struct {
 	Sectors      []Sector
 	Reject       Reject
 	BlockMap     BlockMap
+	Behavior     []byte // Compiled ACS scripts of a Hexen format map
+	NodeFormat   NodeFormat
 	RootNode     *Node
+
+	// FixedPoint makes queries such as SubSectorAt use vanilla Doom's 16.16 fixed point arithmetic,
+	// so that they give the same answers as the game at the edges of lines
+	FixedPoint bool
+
+	// Kept for writing the level back
+	orgVertexes     int       // Number of vertexes in VERTEXES with extended nodes, or zero
+	nodesCompressed bool      // Extended nodes were zlib compressed
+	rejectLump      []byte    // REJECT as read, written back if Reject is unchanged
+	blockMapLump    []byte    // BLOCKMAP as read, written back if BlockMap is unchanged
+	mapNodes        *mapNodes // Nodes in the map lumps, written back in place of GL nodes
 }
 
 type binThing struct {
@@ -471,6 +563,18 @@ type binThing struct {
 	Options int16
 }
 
+type binHexenThing struct {
+	TID     int16
+	X       int16
+	Y       int16
+	Z       int16 // Height above the floor
+	Angle   int16
+	Type    int16
+	Options int16
+	Special uint8
+	Args    [5]uint8
+}
+
 // Things represent players, monsters, pick-ups, and projectiles. Inside the game, these are known
 // as actors, or mobjs. They also represent obstacles, certain decorations, player start positions
 // and teleport landing sites.
@@ -487,6 +591,23 @@ type Thing struct {
 	Skill4and5      bool
 	Ambush          bool
 	MultiplayerOnly bool
+
+	// Hexen format maps only
+	TID          int // Thing ID, used by specials to refer to the thing
+	Z            int // Height above the floor
+	Special      int // Action special run when the thing is killed or picked up
+	Args         [5]int
+	Dormant      bool
+	Fighter      bool // Appears for the fighter class
+	Cleric       bool
+	Mage         bool
+	SinglePlayer bool
+	Cooperative  bool
+	Deathmatch   bool
+
+	Fields map[string]any // All fields of a UDMF map's thing, keyed by lower case name
+
+	otherFlags int // Option bits without a field, kept for writing the thing back
 }
 
 type binVertex struct {
@@ -541,6 +662,13 @@ type DMXGUS struct{}
 // WAD eight-character string type. Null-terminated for short strings.
 type String8 [8]byte
 
+// newString8 converts a string to String8, truncating long strings and zero padding short ones
+func newString8(s string) String8 {
+	var s8 String8
+	copy(s8[:], s)
+	return s8
+}
+
 // String converts String8 to string
 func (s String8) String() string {
 	i := bytes.IndexByte(s[:], 0)
@@ -553,33 +681,129 @@ func (s String8) String() string {
 // Special lump names
 const SkyFlatName = "F_SKY1"
 
+// DefaultTransparentIndex is the column value used for transparent picture pixels
+const DefaultTransparentIndex = 255
+
 // /////////////////////////////////////
 // NewWAD reads WAD metadata to memory. It returns a WAD object that
 // can be used to read individual lumps.
+// Any PWADs are layered over the IWAD in the order given, so that when lumps share a name the
+// last loaded wins, as with Doom's -file parameter.
 // /////////////////////////////////////
-func NewWAD(filename string) (*WAD, error) {
-	logger.Println("Start reading WAD")
+func NewWAD(filename string, pwads ...string) (*WAD, error) {
+	return NewWADWithOptions(nil, filename, pwads...)
+}
 
-	// Open file
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// NewWADWithOptions is NewWAD with loading controlled by opts. A nil opts loads with the default
+// options, as for the other WithOptions constructors.
+func NewWADWithOptions(opts *Options, filename string, pwads ...string) (*WAD, error) {
+	archives := make([]*archive, 0, 1+len(pwads))
+	for _, name := range append([]string{filename}, pwads...) {
+		a, err := openFileArchive(name)
+		if err != nil {
+			closeArchives(archives)
+			return nil, err
+		}
+		archives = append(archives, a)
 	}
-	wad := &WAD{file: file}
+	return newWAD(archives, opts)
+}
 
-	// Read header
-	var binHeader binHeader
-	if err := binary.Read(file, binary.LittleEndian, &binHeader); err != nil {
-		return nil, err
+// NewWADFromReaderAt reads a WAD from size bytes of r. The reader must remain valid for as long as
+// the WAD is in use.
+func NewWADFromReaderAt(r io.ReaderAt, size int64) (*WAD, error) {
+	return NewWADFromReaderAtWithOptions(nil, r, size)
+}
+
+// NewWADFromReaderAtWithOptions is NewWADFromReaderAt with loading controlled by opts
+func NewWADFromReaderAtWithOptions(opts *Options, r io.ReaderAt, size int64) (*WAD, error) {
+	return newWAD([]*archive{{name: "reader", r: r, size: size}}, opts)
+}
+
+// NewWADFromBytes reads a WAD, with any PWADs layered over it, from in-memory data.
+func NewWADFromBytes(iwad []byte, pwads ...[]byte) (*WAD, error) {
+	return NewWADFromBytesWithOptions(nil, iwad, pwads...)
+}
+
+// NewWADFromBytesWithOptions is NewWADFromBytes with loading controlled by opts
+func NewWADFromBytesWithOptions(opts *Options, iwad []byte, pwads ...[]byte) (*WAD, error) {
+	archives := make([]*archive, 0, 1+len(pwads))
+	for i, data := range append([][]byte{iwad}, pwads...) {
+		archives = append(archives, &archive{
+			name: fmt.Sprintf("bytes %v", i),
+			r:    bytes.NewReader(data),
+			size: int64(len(data)),
+		})
 	}
-	if string(binHeader.Magic[:]) != "IWAD" {
-		return nil, fmt.Errorf("bad magic: %s", binHeader.Magic)
+	return newWAD(archives, opts)
+}
+
+// NewWADFromFS reads a WAD, with any PWADs layered over it, from a file system such as an
+// embed.FS.
+func NewWADFromFS(fsys fs.FS, name string, pwads ...string) (*WAD, error) {
+	return NewWADFromFSWithOptions(nil, fsys, name, pwads...)
+}
+
+// NewWADFromFSWithOptions is NewWADFromFS with loading controlled by opts
+func NewWADFromFSWithOptions(opts *Options, fsys fs.FS, name string,
+	pwads ...string) (*WAD, error) {
+	archives := make([]*archive, 0, 1+len(pwads))
+	for _, name := range append([]string{name}, pwads...) {
+		a, err := openFSArchive(fsys, name)
+		if err != nil {
+			closeArchives(archives)
+			return nil, err
+		}
+		archives = append(archives, a)
 	}
-	wad.header = &Header{int(binHeader.NumLumps), int(binHeader.InfoTableOfs)}
+	return newWAD(archives, opts)
+}
 
-	// Read info tables
-	if err := wad.readInfoTables(); err != nil {
-		return nil, err
+// NewWADFromSources reads a WAD, with any PWADs layered over it, from random access sources such
+// as *bytes.Reader or *io.SectionReader.
+func NewWADFromSources(iwad Source, pwads ...Source) (*WAD, error) {
+	return NewWADFromSourcesWithOptions(nil, iwad, pwads...)
+}
+
+// NewWADFromSourcesWithOptions is NewWADFromSources with loading controlled by opts
+func NewWADFromSourcesWithOptions(opts *Options, iwad Source, pwads ...Source) (*WAD, error) {
+	archives := make([]*archive, 0, 1+len(pwads))
+	for i, src := range append([]Source{iwad}, pwads...) {
+		archives = append(archives, &archive{
+			name: fmt.Sprintf("source %v", i),
+			r:    src,
+			size: src.Size(),
+		})
+	}
+	return newWAD(archives, opts)
+}
+
+// newWAD reads the archives' directories and loads resources. The first archive must be an IWAD.
+func newWAD(archives []*archive, opts *Options) (_ *WAD, err error) {
+	logger.Println("Start reading WAD")
+	wad := &WAD{archives: archives}
+	if opts != nil {
+		wad.options = *opts
+	}
+
+	// Release the archives if loading fails at any point
+	defer func() {
+		if err != nil {
+			wad.Close()
+		}
+	}()
+
+	// Read headers and info tables
+	for i, a := range archives {
+		if err := a.readHeader(); err != nil {
+			return nil, err
+		}
+		if i == 0 && !a.isIWAD {
+			return nil, fmt.Errorf("%v: not an IWAD", a.name)
+		}
+		if err := wad.readInfoTables(a); err != nil {
+			return nil, err
+		}
 	}
 
 	// Read PLAYPAL
@@ -588,7 +812,7 @@ func NewWAD(filename string) (*WAD, error) {
 		return nil, err
 	}
 	wad.Palettes = playpal
-	wad.TransparentIndex = 255
+	wad.TransparentIndex = DefaultTransparentIndex
 
 	// Read COLORMAP
 	colorMaps, err := wad.readColorMaps()
@@ -624,6 +848,35 @@ func NewWAD(filename string) (*WAD, error) {
 		return nil, err
 	}
 
+	// Index resources
+	wad.textureDefs, wad.textureNums, err = wad.readTextureDefs()
+	if err != nil {
+		return nil, err
+	}
+	wad.flatLumps = wad.namespaceLumps(flatMarkers)
+	if wad.flatLumps == nil {
+		return nil, fmt.Errorf("F_START not found")
+	}
+	wad.flatNums = make(map[string]int)
+	for i, lumpNum := range wad.flatLumps {
+		wad.flatNums[wad.lumpInfos[lumpNum].Name] = i
+	}
+	wad.spriteLumps, err = wad.indexSprites()
+	if err != nil {
+		return nil, err
+	}
+
+	// Resources are decoded on first use when loading lazily
+	wad.Pictures = make(map[string]*Picture)
+	if wad.options.Lazy {
+		wad.Textures = make(map[string]*Texture)
+		wad.Flats = make(map[string]*Flat)
+		wad.Sprites = make(map[string]*Sprite)
+		wad.Sounds = make(map[string]*Sound)
+		wad.Scores = make(map[string]*MusicScore)
+		return wad, nil
+	}
+
 	// Read patchPics into Pictures map
 	err = wad.readPatchPics()
 	if err != nil {
@@ -678,41 +931,91 @@ func NewWAD(filename string) (*WAD, error) {
 	return wad, nil
 }
 
-func (w *WAD) readInfoTables() error {
-	if err := w.seek(int64(w.header.InfoTableOfs)); err != nil {
-		return err
+// readInfoTables appends the archive's lumps to the WAD directory. Lumps in later archives
+// replace earlier lumps of the same name.
+func (w *WAD) readInfoTables(a *archive) error {
+	tableSize := int64(a.header.NumLumps) * int64(unsafe.Sizeof(binLumpInfo{}))
+	reader := io.NewSectionReader(a.r, int64(a.header.InfoTableOfs), tableSize)
+	if w.lumpNums == nil {
+		w.lumpNums = map[string]int{}
+		w.levels = map[string]int{}
 	}
-	lumpNums := map[string]int{}
-	levels := map[string]int{}
-	lumpInfos := make([]LumpInfo, w.header.NumLumps)
-	for i := 0; i < w.header.NumLumps; i++ {
+	first := len(w.lumpInfos)
+	for i := first; i < first+a.header.NumLumps; i++ {
 		var binInfo binLumpInfo
-		if err := binary.Read(w.file, binary.LittleEndian, &binInfo); err != nil {
+		if err := binary.Read(reader, binary.LittleEndian, &binInfo); err != nil {
 			return err
 		}
-		lumpInfo := LumpInfo{binInfo.Name.String(), int(binInfo.Filepos), int(binInfo.Size)}
-		if lumpInfo.Name == "THINGS" {
+		lumpInfo := LumpInfo{binInfo.Name.String(), int(binInfo.Filepos), int(binInfo.Size), a}
+		if binInfo.Size < 0 || binInfo.Size > 0 && (binInfo.Filepos < 0 || int64(binInfo.Filepos)+int64(binInfo.Size) > a.size) {
+			return fmt.Errorf("%v: lump %v out of bounds", a.name, lumpInfo.Name)
+		}
+		if (lumpInfo.Name == "THINGS" || lumpInfo.Name == "TEXTMAP") && i > first {
 			lumpNum := i - 1
-			info := lumpInfos[lumpNum]
-			levels[info.Name] = lumpNum
+			info := w.lumpInfos[lumpNum]
+			w.levels[info.Name] = lumpNum
 		}
-		lumpNums[lumpInfo.Name] = i
-		lumpInfos[i] = lumpInfo
+		w.lumpNums[lumpInfo.Name] = i
+		w.lumpInfos = append(w.lumpInfos, lumpInfo)
 	}
-	w.levels = levels
-	w.lumpNums = lumpNums
-	w.lumpInfos = lumpInfos
 	return nil
 }
 
+// A namespace is a range of lumps delimited by marker lumps. Vanilla IWADs use F_START/F_END and
+// S_START/S_END, while PWADs built by deutex and similar tools use FF_START/FF_END and
+// SS_START/SS_END, sometimes mixed with the single letter forms.
+type namespace struct {
+	starts, ends []string
+}
+
+var (
+	flatMarkers   = namespace{[]string{"F_START", "FF_START"}, []string{"F_END", "FF_END"}}
+	spriteMarkers = namespace{[]string{"S_START", "SS_START"}, []string{"S_END", "SS_END"}}
+)
+
+// namespaceLumps returns the numbers of the lumps in a namespace, merged across all archives in
+// load order. A lump in a later archive replaces an earlier lump of the same name in place, and
+// new lumps are appended. Nested markers such as F1_START are skipped. Returns nil if no archive
+// contains the namespace.
+func (w *WAD) namespaceLumps(ns namespace) []int {
+	var lumpNums []int
+	positions := map[string]int{}
+	var current *archive
+	inside := false
+	for i, li := range w.lumpInfos {
+		if li.archive != current {
+			current = li.archive
+			inside = false
+		}
+		switch {
+		case slices.Contains(ns.starts, li.Name):
+			inside = true
+			if lumpNums == nil {
+				lumpNums = []int{}
+			}
+		case slices.Contains(ns.ends, li.Name):
+			inside = false
+		case inside && li.Size > 0:
+			if pos, ok := positions[li.Name]; ok {
+				lumpNums[pos] = i
+			} else {
+				positions[li.Name] = len(lumpNums)
+				lumpNums = append(lumpNums, i)
+			}
+		}
+	}
+	return lumpNums
+}
+
 // readPlaypal
 func (w *WAD) readPlaypal() (*Palettes, error) {
 	logger.Println("Loading PLAYPAL ...")
-	if err := w.seekLumpName("PLAYPAL"); err != nil {
+	reader, err := w.lumpReaderName("PLAYPAL")
+	if err != nil {
 		return nil, err
 	}
 	playpal := Palettes{}
-	if err := binary.Read(w.file, binary.LittleEndian, &playpal); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &playpal); err != nil {
 		return nil, err
 	}
 	return &playpal, nil
@@ -721,11 +1024,12 @@ func (w *WAD) readPlaypal() (*Palettes, error) {
 // readColorMaps
 func (w *WAD) readColorMaps() (*ColorMaps, error) {
 	logger.Println("Loading COLORMAP ...")
-	if err := w.seekLumpName("COLORMAP"); err != nil {
+	reader, err := w.lumpReaderName("COLORMAP")
+	if err != nil {
 		return nil, err
 	}
 	colormaps := ColorMaps{}
-	if err := binary.Read(w.file, binary.LittleEndian, &colormaps); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &colormaps); err != nil {
 		return nil, err
 	}
 	return &colormaps, nil
@@ -734,11 +1038,12 @@ func (w *WAD) readColorMaps() (*ColorMaps, error) {
 // readEndoom reads the ENDOOM lump
 func (w *WAD) readEndoom() (*Endoom, error) {
 	logger.Println("Loading ENDOOM ...")
-	if err := w.seekLumpName("ENDOOM"); err != nil {
+	reader, err := w.lumpReaderName("ENDOOM")
+	if err != nil {
 		return nil, err
 	}
 	endoom := Endoom{}
-	if err := binary.Read(w.file, binary.LittleEndian, &endoom); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &endoom); err != nil {
 		return nil, err
 	}
 	return &endoom, nil
@@ -757,20 +1062,21 @@ func (w *WAD) readDMXGUS() (*DMXGUS, error) {
 // readPatchNames reads the PNAMES lump to populate a slice of patch names
 func (w *WAD) readPatchNames() ([]string, error) {
 	logger.Printf("Loading patch names ...\n")
-	if err := w.seekLumpName("PNAMES"); err != nil {
+	reader, err := w.lumpReaderName("PNAMES")
+	if err != nil {
 		return nil, err
 	}
 
 	// Read PNAMES header
 	var count uint32
-	if err := binary.Read(w.file, binary.LittleEndian, &count); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
 		return nil, err
 	}
 
 	// Read and translate PNAMES body
 	pnames := make([]String8, count)
 	patchNames := make([]string, count)
-	if err := binary.Read(w.file, binary.LittleEndian, pnames); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, pnames); err != nil {
 		return nil, err
 	}
 	for i, p := range pnames {
@@ -788,16 +1094,24 @@ func (w *WAD) readPatchPics() error {
 			continue
 		}
 	}
-	logger.Printf("Loaded %v patch pictures", len(w.Pictures))
+	logger.Printf("Loaded %v patch pictures", w.numPictures())
 
 	return nil
 }
 
-func (w *WAD) readTextures() (map[string]*Texture, []*Texture, error) {
-	logger.Println("Loading textures ...")
+// textureDef is a texture definition from a TEXTUREx lump, before its patches are composited
+type textureDef struct {
+	header  binTextureHeader
+	patches []binPatch
+}
 
-	textures := make(map[string]*Texture)
-	texturesList := make([]*Texture, 0)
+// readTextureDefs reads the texture definitions from the TEXTURE1 and TEXTURE2 lumps. The
+// definitions are small, so they are always read up front, even when loading lazily.
+func (w *WAD) readTextureDefs() ([]textureDef, map[string]int, error) {
+	logger.Println("Loading texture definitions ...")
+
+	defs := make([]textureDef, 0)
+	textureNums := make(map[string]int)
 	for i := 1; i < 10; i++ {
 
 		name := fmt.Sprintf("TEXTURE%v", i)
@@ -806,218 +1120,339 @@ func (w *WAD) readTextures() (map[string]*Texture, []*Texture, error) {
 		if !ok {
 			continue
 		}
-		lumpInfo := w.lumpInfos[lumpNum]
-		if err := w.seekLumpName(name); err != nil {
-			continue
-		}
+		reader := w.lumpReader(&w.lumpInfos[lumpNum])
 		logger.Printf("Loading %v ...", name)
 
 		// Read header
 		var count uint32
-		if err := binary.Read(w.file, binary.LittleEndian, &count); err != nil {
+		if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
 			return nil, nil, err
 		}
+		if int64(count)*4 > reader.Size() {
+			return nil, nil, fmt.Errorf("%v: bad texture count %v", name, count)
+		}
 		offsets := make([]int32, count)
 
 		// Read offsets
-		if err := binary.Read(w.file, binary.LittleEndian, offsets); err != nil {
+		if err := binary.Read(reader, binary.LittleEndian, offsets); err != nil {
 			return nil, nil, err
 		}
 
 		// For each offset...
 		for _, offset := range offsets {
-			if err := w.seek(int64(lumpInfo.Filepos) + int64(offset)); err != nil {
+			if _, err := reader.Seek(int64(offset), io.SeekStart); err != nil {
 				return nil, nil, err
 			}
 
 			// Read header
-			var binHeader binTextureHeader
-			if err := binary.Read(w.file, binary.LittleEndian, &binHeader); err != nil {
+			var def textureDef
+			if err := binary.Read(reader, binary.LittleEndian, &def.header); err != nil {
 				return nil, nil, err
 			}
 
-			// Create texture
-			texture := &Texture{
-				Name:     binHeader.TextureName.String(),
-				IsMasked: binHeader.Masked != 0,
-				Width:    int(binHeader.Width),
-				Height:   int(binHeader.Height),
-			}
-
-			// Add patches to texture
-			binPatches := make([]binPatch, binHeader.NumPatches)
-			patches := make([]Patch, binHeader.NumPatches)
-			if err := binary.Read(w.file, binary.LittleEndian, binPatches); err != nil {
+			// Read patches
+			def.patches = make([]binPatch, max(def.header.NumPatches, 0))
+			if err := binary.Read(reader, binary.LittleEndian, def.patches); err != nil {
 				return nil, nil, err
 			}
-			for pi, p := range binPatches {
-				patches[pi] = Patch{
-					XOffset: int(p.XOffset),
-					YOffset: int(p.YOffset),
-					Picture: w.Pictures[w.patchNames[p.PatchNameIdx]],
-				}
-			}
-			texture.Patches = patches
-
-			// Expand out patches to create composite Picture
-			picture := &Picture{
-				Name:       texture.Name,
-				Width:      texture.Width,
-				Height:     texture.Height,
-				LeftOffset: 0,
-				TopOffset:  0,
-				Columns:    make([]Column, int(texture.Width)),
-			}
-			for i := range picture.Columns {
-				picture.Columns[i] = make([]byte, int(texture.Height))
-			}
-			for _, p := range texture.Patches {
-				sourceYOffset := 0
-				if p.YOffset < 0 {
-					sourceYOffset = -p.YOffset
-					p.YOffset = 0
-				}
-				for y, c := range p.Picture.Columns {
-					if p.XOffset+y >= 0 && p.XOffset+y < len(picture.Columns) {
-						copy(picture.Columns[p.XOffset+y][p.YOffset:], c[sourceYOffset:])
-					}
-				}
-			}
-			texture.Picture = picture
 
-			texture.Index = len(texturesList)
-			textures[texture.Name] = texture
-			texturesList = append(texturesList, texture)
+			textureNums[def.header.TextureName.String()] = len(defs)
+			defs = append(defs, def)
 		}
 	}
+	return defs, textureNums, nil
+}
+
+// readTextures composites every texture
+func (w *WAD) readTextures() (map[string]*Texture, []*Texture, error) {
+	logger.Println("Loading textures ...")
+
+	textures := make(map[string]*Texture)
+	texturesList := make([]*Texture, len(w.textureDefs))
+	parallelFor(len(w.textureDefs), w.options.Workers, func(i int) {
+		texturesList[i] = w.readTexture(i)
+	})
+	for _, texture := range texturesList {
+		textures[texture.Name] = texture
+	}
 	logger.Printf("Loaded %v textures", len(textures))
 
 	return textures, texturesList, nil
 }
 
-// readFlats
-func (w *WAD) readFlats() (map[string]*Flat, []*Flat, error) {
-	logger.Println("Loading flats ...")
+// readTexture creates a texture from its definition, expanding out its patches to create a
+// composite Picture. Missing patches are logged and left out.
+func (w *WAD) readTexture(index int) *Texture {
+	def := &w.textureDefs[index]
 
-	flats := make(map[string]*Flat)
-	flatsList := make([]*Flat, 0)
-	startLump, ok := w.lumpNums["F_START"]
-	if !ok {
-		return nil, nil, fmt.Errorf("F_START not found")
-	}
-	endLump, ok := w.lumpNums["F_END"]
-	if !ok {
-		return nil, nil, fmt.Errorf("F_END not found")
+	// Create texture
+	texture := &Texture{
+		Name:     def.header.TextureName.String(),
+		Index:    index,
+		IsMasked: def.header.Masked != 0,
+		Width:    int(def.header.Width),
+		Height:   int(def.header.Height),
 	}
 
-	// For each flat lump
-	for i := startLump; i < endLump; i++ {
-		lumpInfo := w.lumpInfos[i]
+	// Add patches to texture
+	patches := make([]Patch, len(def.patches))
+	for pi, p := range def.patches {
+		patches[pi] = Patch{
+			XOffset: int(p.XOffset),
+			YOffset: int(p.YOffset),
+		}
+		if int(p.PatchNameIdx) < 0 || int(p.PatchNameIdx) >= len(w.patchNames) {
+			logger.Printf("Err: %v: bad patch index %v", texture.Name, p.PatchNameIdx)
+			continue
+		}
+		picture, err := w.GetPicture(w.patchNames[p.PatchNameIdx])
+		if err != nil {
+			logger.Printf("Err: %v", err)
+			continue
+		}
+		patches[pi].Picture = picture
+	}
+	texture.Patches = patches
 
-		// Skip marker lumps
-		if lumpInfo.Size == 0 {
+	// Expand out patches to create composite Picture
+	picture := &Picture{
+		Name:             texture.Name,
+		Width:            texture.Width,
+		Height:           texture.Height,
+		LeftOffset:       0,
+		TopOffset:        0,
+		Columns:          make([]Column, max(texture.Width, 0)),
+		TransparentIndex: w.TransparentIndex,
+	}
+	for i := range picture.Columns {
+		picture.Columns[i] = bytes.Repeat([]byte{w.TransparentIndex}, max(texture.Height, 0))
+	}
+	for _, p := range texture.Patches {
+		if p.Picture == nil {
 			continue
 		}
+		sourceYOffset := 0
+		if p.YOffset < 0 {
+			sourceYOffset = -p.YOffset
+			p.YOffset = 0
+		}
+		for y, c := range p.Picture.Columns {
+			if p.XOffset+y < 0 || p.XOffset+y >= len(picture.Columns) {
+				continue
+			}
+
+			// Copy only the patch's posts, so that later patches overlay earlier ones
+			dest := picture.Columns[p.XOffset+y]
+			for i := sourceYOffset; i < len(c) && p.YOffset+i-sourceYOffset < len(dest); i++ {
+				if c[i] != p.Picture.TransparentIndex {
+					dest[p.YOffset+i-sourceYOffset] = c[i]
+				}
+			}
+		}
+	}
+	texture.Picture = picture
 
-		// Allocate Flat
-		var flat Flat
-		flat.Data = make([]byte, FlatHeight*FlatWidth)
+	return texture
+}
 
-		// Read lump and add to slice
-		if err := w.seek(int64(lumpInfo.Filepos)); err != nil {
-			return nil, nil, err
+// Texture returns the named texture, compositing and caching it on first use
+func (w *WAD) Texture(name string) (*Texture, error) {
+	name = strings.ToUpper(name)
+	return cached(w, w.Textures, name, func() (*Texture, error) {
+		index, ok := w.textureNums[name]
+		if !ok {
+			return nil, fmt.Errorf("texture %v not found", name)
 		}
-		if err := binary.Read(w.file, binary.LittleEndian, flat.Data); err != nil {
+		return w.readTexture(index), nil
+	})
+}
+
+// textureOrNil
+func (w *WAD) textureOrNil(name string) *Texture {
+	t, _ := w.Texture(name)
+	return t
+}
+
+// readFlats
+func (w *WAD) readFlats() (map[string]*Flat, []*Flat, error) {
+	logger.Println("Loading flats ...")
+
+	flats := make(map[string]*Flat)
+	flatsList := make([]*Flat, 0, len(w.flatLumps))
+
+	// For each flat lump
+	for i := range w.flatLumps {
+		flat, err := w.readFlat(i)
+		if err != nil {
 			return nil, nil, err
 		}
-
-		flat.Name = lumpInfo.Name
-		flat.Index = len(flatsList)
-		flats[lumpInfo.Name] = &flat
-		flatsList = append(flatsList, &flat)
+		flats[flat.Name] = flat
+		flatsList = append(flatsList, flat)
 	}
 	logger.Printf("Loaded %v flats", len(flats))
 	return flats, flatsList, nil
 }
 
+// readFlat reads the flat at the given position in the flat namespace
+func (w *WAD) readFlat(index int) (*Flat, error) {
+	lumpInfo := w.lumpInfos[w.flatLumps[index]]
+
+	// Allocate Flat
+	var flat Flat
+	flat.Data = make([]byte, FlatHeight*FlatWidth)
+
+	// Read lump
+	reader := w.lumpReader(&lumpInfo)
+	if err := binary.Read(reader, binary.LittleEndian, flat.Data); err != nil {
+		return nil, err
+	}
+
+	flat.Name = lumpInfo.Name
+	flat.Index = index
+	return &flat, nil
+}
+
+// Flat returns the named flat, reading and caching it on first use
+func (w *WAD) Flat(name string) (*Flat, error) {
+	name = strings.ToUpper(name)
+	return cached(w, w.Flats, name, func() (*Flat, error) {
+		index, ok := w.flatNums[name]
+		if !ok {
+			return nil, fmt.Errorf("flat %v not found", name)
+		}
+		return w.readFlat(index)
+	})
+}
+
+// flatOrNil
+func (w *WAD) flatOrNil(name string) *Flat {
+	f, _ := w.Flat(name)
+	return f
+}
+
 // readSounds
 func (w *WAD) readSounds() (map[string]*Sound, error) {
 	logger.Printf("Loading DS sounds ...")
 	sounds := make(map[string]*Sound)
 
 	// Check all lumps for sounds
-	for _, li := range w.lumpInfos {
+	for i, li := range w.lumpInfos {
 
 		// Skip non-sound lumps
-		if li.Name[:2] != "DS" {
+		if !strings.HasPrefix(li.Name, "DS") {
 			continue
 		}
 
-		// Read header
-		if err := w.seek(int64(li.Filepos)); err != nil {
-			return nil, err
-		}
-		var header binSoundHeader
-		if err := binary.Read(w.file, binary.LittleEndian, &header); err != nil {
+		sound, err := w.readSound(&w.lumpInfos[i])
+		if err != nil {
 			return nil, err
 		}
-		if header.Format != 3 {
+		if sound == nil {
 			logger.Printf("Skipping unexpected sound format")
 			continue
 		}
+		sounds[li.Name] = sound
+	}
+	logger.Printf("Loaded %v sounds", len(sounds))
+	return sounds, nil
+}
+
+// readSound reads a DMX format sound lump. Returns nil if the lump is in another format.
+func (w *WAD) readSound(li *LumpInfo) (*Sound, error) {
+	lump, err := w.readLump(li)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSound(lump)
+}
 
-		// Read the samples
-		numSamples := header.Bytes - 32 // Subtract 32 pad bytes
-		samples := make([]byte, numSamples)
-		if err := binary.Read(w.file, binary.LittleEndian, samples); err != nil {
+// Sound returns the named DS sound, reading and caching it on first use
+func (w *WAD) Sound(name string) (*Sound, error) {
+	name = strings.ToUpper(name)
+	return cached(w, w.Sounds, name, func() (*Sound, error) {
+		lumpNum, ok := w.lumpNums[name]
+		if !ok || !strings.HasPrefix(name, "DS") {
+			return nil, fmt.Errorf("sound %v not found", name)
+		}
+		s, err := w.readSound(&w.lumpInfos[lumpNum])
+		if err != nil {
 			return nil, err
 		}
-		sounds[li.Name] = &Sound{
-			SampleRate: uint(header.SampleRate),
-			Samples:    samples,
+		if s == nil {
+			return nil, fmt.Errorf("sound %v: unexpected format", name)
 		}
-	}
-	logger.Printf("Loaded %v sounds", len(sounds))
-	return sounds, nil
+		return s, nil
+	})
 }
 
-// readSounds
+// readMusic
 func (w *WAD) readMusic() (map[string]*MusicScore, error) {
 	logger.Printf("Loading music ...")
 	scores := make(map[string]*MusicScore)
 
 	// Check all lumps for music
-	for _, li := range w.lumpInfos {
+	for i, li := range w.lumpInfos {
 
 		// Skip non-sound lumps
-		if li.Name[:2] != "D_" {
+		if !strings.HasPrefix(li.Name, "D_") {
 			continue
 		}
 
-		// Read header
-		if err := w.seek(int64(li.Filepos)); err != nil {
-			return nil, err
-		}
-		var header binMusicHeader
-		if err := binary.Read(w.file, binary.LittleEndian, &header); err != nil {
-			return nil, err
+		score, err := w.readScore(&w.lumpInfos[i])
+		if err != nil {
+			logger.Printf("Err: %v: %v", li.Name, err)
+			continue
 		}
+		scores[li.Name] = score
+	}
+	logger.Printf("Loaded %v scores", len(scores))
+	return scores, nil
+}
 
-		// Read the instruments
-		samples := make(binMusicInstruments, header.InstrumentCount)
-		if err := binary.Read(w.file, binary.LittleEndian, samples); err != nil {
-			return nil, err
+// readScore reads and decodes a MUS lump
+func (w *WAD) readScore(li *LumpInfo) (*MusicScore, error) {
+	lump, err := w.readLump(li)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeMusic(lump)
+}
+
+// Score returns the named music score, such as "D_E1M1", decoding and caching it on first use
+func (w *WAD) Score(name string) (*MusicScore, error) {
+	name = strings.ToUpper(name)
+	return cached(w, w.Scores, name, func() (*MusicScore, error) {
+		lumpNum, ok := w.lumpNums[name]
+		if !ok || !strings.HasPrefix(name, "D_") {
+			return nil, fmt.Errorf("score %v not found", name)
+		}
+		score, err := w.readScore(&w.lumpInfos[lumpNum])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
 		}
+		return score, nil
+	})
+}
 
-		// Read sound events
+// indexSprites groups the lumps in the sprite namespace by sprite name
+func (w *WAD) indexSprites() (map[string][]int, error) {
 
-		// 	scores[li.Name] = &Score{
-		// 		SampleRate: uint(header.SampleRate),
-		// 		Samples:    samples,
-		// 	}
+	// Find sprite lumps
+	lumpNums := w.namespaceLumps(spriteMarkers)
+	if lumpNums == nil {
+		return nil, fmt.Errorf("S_START not found")
 	}
-	logger.Printf("Loaded %v scores", len(scores))
-	return scores, nil
+
+	spriteLumps := make(map[string][]int)
+	for _, i := range lumpNums {
+		name := w.lumpInfos[i].Name
+		if len(name) < 6 {
+			logger.Println("ERR: Bad sprite name:", name)
+			continue
+		}
+		spriteLumps[name[:4]] = append(spriteLumps[name[:4]], i)
+	}
+	return spriteLumps, nil
 }
 
 // readSprites
@@ -1027,26 +1462,30 @@ func (w *WAD) readMusic() (map[string]*MusicScore, error) {
 func (w *WAD) readSprites() (map[string]*Sprite, error) {
 	logger.Println("Loading sprites ...")
 	sprites := make(map[string]*Sprite)
-
-	// Find start and end lumps
-	startLump, ok := w.lumpNums["S_START"]
-	if !ok {
-		return nil, fmt.Errorf("S_START not found")
+	spriteNames := make([]string, 0, len(w.spriteLumps))
+	for spriteName := range w.spriteLumps {
+		spriteNames = append(spriteNames, spriteName)
 	}
-	endLump, ok := w.lumpNums["S_END"]
-	if !ok {
-		return nil, fmt.Errorf("S_END not found")
+	spritesList := make([]*Sprite, len(spriteNames))
+	parallelFor(len(spriteNames), w.options.Workers, func(i int) {
+		spritesList[i] = w.readSprite(spriteNames[i])
+	})
+	for i, spriteName := range spriteNames {
+		sprites[spriteName] = spritesList[i]
 	}
+	logger.Printf("Loaded %v sprites", len(sprites))
+	logger.Printf("(Loaded %v pictures)", w.numPictures())
+	return sprites, nil
+}
+
+// readSprite builds a sprite from its picture lumps
+func (w *WAD) readSprite(spriteName string) *Sprite {
+	sprite := new(Sprite)
 
 	// For each sprite picture lump
-	for i := startLump; i < endLump; i++ {
+	for _, i := range w.spriteLumps[spriteName] {
 		lumpInfo := w.lumpInfos[i]
 
-		// Skip marker lumps
-		if lumpInfo.Size == 0 {
-			continue
-		}
-
 		// Read lump into Picture format
 		picture, err := w.GetPicture(lumpInfo.Name)
 		if err != nil {
@@ -1054,12 +1493,12 @@ func (w *WAD) readSprites() (map[string]*Sprite, error) {
 			continue
 		}
 
-		// Construct sprite name
-		spriteName := lumpInfo.Name[:4]
-		spriteframe := int(lumpInfo.Name[4] - 'A')
-		sprite, ok := sprites[spriteName]
-		if !ok {
-			sprite = new(Sprite)
+		// Find frame and rotation
+		spriteframe := int(lumpInfo.Name[4]) - 'A'
+		rotation := lumpInfo.Name[5] - '1'
+		if spriteframe < 0 || (rotation > 7 && rotation != 0xff) {
+			logger.Println("ERR: Bad sprite frame:", lumpInfo.Name)
+			continue
 		}
 
 		// Grow sprite slice to fit this slice frame
@@ -1069,13 +1508,12 @@ func (w *WAD) readSprites() (map[string]*Sprite, error) {
 		sf := &(*sprite)[spriteframe]
 
 		// If rotation zero, use this picture for all sprite directions
-		rotation := lumpInfo.Name[5] - '1'
 		if rotation == 0xff {
 			for i := range 8 {
-				sf[i].Picture = picture
+				sf[i] = SpriteFrameDir{Picture: picture}
 			}
 		} else {
-			sf[rotation].Picture = picture
+			sf[rotation] = SpriteFrameDir{Picture: picture}
 		}
 
 		if len(lumpInfo.Name) >= 8 {
@@ -1084,19 +1522,26 @@ func (w *WAD) readSprites() (map[string]*Sprite, error) {
 				continue
 			}
 			rotation := lumpInfo.Name[7] - '1'
-			if rotation == 0xff {
+			if rotation == 0xff || rotation > 7 {
 				logger.Println("ERR: Flipped all rotation:", lumpInfo.Name)
 				continue
 			}
 			sf[rotation].Picture = picture
 			sf[rotation].IsFlipped = true
 		}
-		sprites[spriteName] = sprite
-
 	}
-	logger.Printf("Loaded %v sprites", len(sprites))
-	logger.Printf("(Loaded %v pictures)", len(w.Pictures))
-	return sprites, nil
+	return sprite
+}
+
+// Sprite returns the named sprite, such as "TROO", building and caching it on first use
+func (w *WAD) Sprite(name string) (*Sprite, error) {
+	name = strings.ToUpper(name)
+	return cached(w, w.Sprites, name, func() (*Sprite, error) {
+		if _, ok := w.spriteLumps[name]; !ok {
+			return nil, fmt.Errorf("sprite %v not found", name)
+		}
+		return w.readSprite(name), nil
+	})
 }
 
 // LevelNames returns a slice of level names found in the WAD archive.
@@ -1114,16 +1559,39 @@ func (w *WAD) ReadLevel(name string, sectorUser any) (*Level, error) {
 	logger.Printf("Reading Level %v ...", name)
 
 	level := Level{}
-	levelIdx := w.levels[name]
-	for i := levelIdx + 1; i < levelIdx+11; i++ {
-		lumpInfo := w.lumpInfos[i]
-		if err := w.seek(int64(lumpInfo.Filepos)); err != nil {
-			return nil, err
+	levelIdx, ok := w.levels[name]
+	if !ok {
+		return nil, fmt.Errorf("level %v not found", name)
+	}
+
+	// Find the map's lumps. A UDMF map runs from TEXTMAP to ENDMAP, and a BEHAVIOR lump marks a
+	// Hexen format map.
+	levelEnd := levelIdx + 1
+	if levelEnd < len(w.lumpInfos) && w.lumpInfos[levelEnd].Name == "TEXTMAP" {
+		level.Format = MapFormatUDMF
+		for levelEnd < len(w.lumpInfos) && w.lumpInfos[levelEnd].Name != "ENDMAP" {
+			levelEnd++
+		}
+	} else {
+		for levelEnd < len(w.lumpInfos) && isMapLump(w.lumpInfos[levelEnd].Name) {
+			if w.lumpInfos[levelEnd].Name == "BEHAVIOR" {
+				level.Format = MapFormatHexen
+			}
+			levelEnd++
 		}
+	}
+
+	var extendedNodes *LumpInfo
+	for i := levelIdx + 1; i < levelEnd; i++ {
+		lumpInfo := w.lumpInfos[i]
 		name := lumpInfo.Name
 		switch name {
 		case "THINGS":
-			things, err := w.readThings(&lumpInfo)
+			readThings := w.readThings
+			if level.Format == MapFormatHexen {
+				readThings = w.readHexenThings
+			}
+			things, err := readThings(&lumpInfo)
 			if err != nil {
 				return nil, err
 			}
@@ -1135,7 +1603,11 @@ func (w *WAD) ReadLevel(name string, sectorUser any) (*Level, error) {
 			}
 			level.Sides = sides
 		case "LINEDEFS":
-			lines, err := w.readLines(&lumpInfo)
+			readLines := w.readLines
+			if level.Format == MapFormatHexen {
+				readLines = w.readHexenLines
+			}
+			lines, err := readLines(&lumpInfo)
 			if err != nil {
 				return nil, err
 			}
@@ -1153,12 +1625,20 @@ func (w *WAD) ReadLevel(name string, sectorUser any) (*Level, error) {
 			}
 			level.LineSegments = segments
 		case "SSECTORS":
+			if w.isExtendedNodes(&lumpInfo) {
+				extendedNodes = &lumpInfo
+				break
+			}
 			subsectors, err := w.readSubSectors(&lumpInfo)
 			if err != nil {
 				return nil, err
 			}
 			level.SubSectors = subsectors
 		case "NODES":
+			if w.isExtendedNodes(&lumpInfo) {
+				extendedNodes = &lumpInfo
+				break
+			}
 			nodes, err := w.readNodes(&lumpInfo)
 			if err != nil {
 				return nil, err
@@ -1171,49 +1651,78 @@ func (w *WAD) ReadLevel(name string, sectorUser any) (*Level, error) {
 			}
 			level.Sectors = sectors
 		case "REJECT":
-			reject, err := w.readReject(&lumpInfo)
+			reject, lump, err := w.readReject(&lumpInfo, len(level.Sectors))
 			if err != nil {
 				return nil, err
 			}
-			level.Reject = *reject
+			level.Reject, level.rejectLump = *reject, lump
 		case "BLOCKMAP":
-			blockMap, err := w.readBlockmap(&lumpInfo)
+			blockMap, lump, err := w.readBlockmap(&lumpInfo)
 			if err != nil {
 				return nil, err
 			}
-			level.BlockMap = *blockMap
+			level.BlockMap, level.blockMapLump = *blockMap, lump
+		case "ZNODES":
+			extendedNodes = &lumpInfo
+		case "TEXTMAP":
+			if err := w.readTextMap(&lumpInfo, &level, sectorUser); err != nil {
+				return nil, err
+			}
+		case "BEHAVIOR":
+			behavior, err := w.readLump(&lumpInfo)
+			if err != nil {
+				return nil, err
+			}
+			level.Behavior = behavior
 		default:
 			logger.Printf("Unhandled lump %s\n", name)
 		}
 	}
 
+	// Extended nodes replace the vanilla segs, subsectors and nodes, and GL nodes replace both
+	if extendedNodes != nil {
+		if err := w.readExtendedNodes(extendedNodes, &level); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.readGLNodes(name, levelEnd, &level); err != nil {
+		return nil, err
+	}
+
 	// Set references
 	w.setReferences(&level)
 
 	return &level, nil
 }
 
-// setReferences adds pointers to all level assets
+// setReferences adds pointers to all level assets. Numbers out of range leave their pointers nil,
+// so that broken maps can still be read and checked with Validate.
 func (w *WAD) setReferences(l *Level) error {
 	logger.Println("Setting references ...")
 
 	// Sides
 	for i := range l.Sides {
-		l.Sides[i].Sector = &l.Sectors[l.Sides[i].SectorNum]
+		if n := l.Sides[i].SectorNum; n >= 0 && n < len(l.Sectors) {
+			l.Sides[i].Sector = &l.Sectors[n]
+		}
 	}
 
 	// Lines - dependent on Sides
 	for i := range l.Lines {
 		li := &l.Lines[i] // Point to element
-		li.V1 = l.Vertexes[li.V1Num]
-		li.V2 = l.Vertexes[li.V2Num]
+		if li.V1Num >= 0 && li.V1Num < len(l.Vertexes) {
+			li.V1 = l.Vertexes[li.V1Num]
+		}
+		if li.V2Num >= 0 && li.V2Num < len(l.Vertexes) {
+			li.V2 = l.Vertexes[li.V2Num]
+		}
 		li.DX = li.V2.X - li.V1.X
 		li.DY = li.V2.Y - li.V1.Y
-		if li.SideRNum >= 0 { // -1 means no Side
+		if li.SideRNum >= 0 && li.SideRNum < len(l.Sides) { // -1 means no Side
 			li.SideR = &l.Sides[li.SideRNum]
 			li.FrontSector = li.SideR.Sector
 		}
-		if li.SideLNum >= 0 { // -1 means no Side
+		if li.SideLNum >= 0 && li.SideLNum < len(l.Sides) { // -1 means no Side
 			li.SideL = &l.Sides[li.SideLNum]
 			li.BackSector = li.SideL.Sector
 		}
@@ -1240,57 +1749,12 @@ func (w *WAD) setReferences(l *Level) error {
 		li.BoundingBox.Left = min(li.V1.X, li.V2.X)
 		li.BoundingBox.Right = max(li.V1.X, li.V2.X)
 		li.BoundingBox.Bottom = min(li.V1.Y, li.V2.Y)
-		li.BoundingBox.Left = max(li.V1.Y, li.V2.Y)
+		li.BoundingBox.Top = max(li.V1.Y, li.V2.Y)
 
 	}
 
-	// Line Segments
-	for i := range l.LineSegments {
-		s := &l.LineSegments[i] // Point to element
-		s.V1 = l.Vertexes[s.V1Num]
-		s.V2 = l.Vertexes[s.V2Num]
-		s.Line = &l.Lines[s.LineNum]
-		if s.IsSideL {
-			s.Side = &l.Sides[s.Line.SideLNum]
-		} else {
-			s.Side = &l.Sides[s.Line.SideRNum]
-		}
-		s.FrontSector = s.Side.Sector
-		if s.Line.TwoSided {
-			if s.IsSideL {
-				s.BackSector = l.Sides[s.Line.SideRNum].Sector
-			} else {
-				s.BackSector = l.Sides[s.Line.SideLNum].Sector
-			}
-		}
-	}
-
-	// SubSectors
-	for i := range l.SubSectors {
-		s := &l.SubSectors[i] // Point to element
-		for j := s.StartLineSegment; j < (s.StartLineSegment + s.numLineSegments); j++ {
-			s.LineSegments = append(s.LineSegments, l.LineSegments[j])
-		}
-		s.Sector = s.LineSegments[0].Side.Sector
-	}
-
-	// Nodes
-	l.RootNode = &l.Nodes[len(l.Nodes)-1]
-	for i := range l.Nodes {
-		n := &l.Nodes[i] // Point to element
-
-		if n.ChildNumR < 0 {
-			n.ChildR = &l.SubSectors[n.ChildNumR&math.MaxInt16]
-		} else {
-			n.ChildR = &l.Nodes[n.ChildNumR]
-		}
-
-		if n.ChildNumL < 0 {
-			n.ChildL = &l.SubSectors[n.ChildNumL&math.MaxInt16]
-		} else {
-			n.ChildL = &l.Nodes[n.ChildNumL]
-		}
-	}
+	// Line segments, subsectors and nodes
+	l.setNodeReferences()
 
 	// Sectors
 	for i := range l.Sectors {
@@ -1310,17 +1774,17 @@ func (w *WAD) setReferences(l *Level) error {
 		s.SoundOrigin.Y = (bbox.Top + bbox.Bottom) / 2
 
 		// adjust bounding box to map blocks
-		block := int(bbox.Top - l.BlockMap.OriginY + MaxRadius)
+		block := int(math.Floor((bbox.Top - l.BlockMap.OriginY + MaxRadius) / BlockSize))
 		s.BlockBox.Top = min(block, l.BlockMap.NumRows-1)
 
-		block = int(bbox.Bottom - l.BlockMap.OriginY - MaxRadius)
+		block = int(math.Floor((bbox.Bottom - l.BlockMap.OriginY - MaxRadius) / BlockSize))
 		s.BlockBox.Bottom = max(block, 0)
 
-		block = int(bbox.Right - l.BlockMap.OriginX + MaxRadius)
+		block = int(math.Floor((bbox.Right - l.BlockMap.OriginX + MaxRadius) / BlockSize))
 		s.BlockBox.Right = min(block, l.BlockMap.NumColumns-1)
 
-		block = int(bbox.Left - l.BlockMap.OriginX - MaxRadius)
-		s.BlockBox.Right = max(block, 0)
+		block = int(math.Floor((bbox.Left - l.BlockMap.OriginX - MaxRadius) / BlockSize))
+		s.BlockBox.Left = max(block, 0)
 
 	}
 
@@ -1328,7 +1792,9 @@ func (w *WAD) setReferences(l *Level) error {
 	for i := range l.BlockMap.Blocks {
 		b := &l.BlockMap.Blocks[i] // Point to element
 		for j := range b.LineNums {
-			b.Lines = append(b.Lines, &l.Lines[b.LineNums[j]])
+			if b.LineNums[j] < len(l.Lines) {
+				b.Lines = append(b.Lines, &l.Lines[b.LineNums[j]])
+			}
 		}
 	}
 
@@ -1349,6 +1815,76 @@ func (w *WAD) setReferences(l *Level) error {
 	return nil
 }
 
+// setNodeReferences adds pointers to the line segments, subsectors and nodes, and sets the
+// subsector polygons
+func (l *Level) setNodeReferences() {
+	// Line Segments
+	for i := range l.LineSegments {
+		s := &l.LineSegments[i] // Point to element
+		if s.V1Num >= 0 && s.V1Num < len(l.Vertexes) {
+			s.V1 = l.Vertexes[s.V1Num]
+		}
+		if s.V2Num >= 0 && s.V2Num < len(l.Vertexes) {
+			s.V2 = l.Vertexes[s.V2Num]
+		}
+		if s.LineNum < 0 || s.LineNum >= len(l.Lines) {
+			continue // Minisegs have no line or sides
+		}
+		s.Line = &l.Lines[s.LineNum]
+		front, back := s.Line.SideRNum, s.Line.SideLNum
+		if s.IsSideL {
+			front, back = back, front
+		}
+		if front < 0 || front >= len(l.Sides) {
+			continue
+		}
+		s.Side = &l.Sides[front]
+		s.FrontSector = s.Side.Sector
+		if s.Line.TwoSided && back >= 0 && back < len(l.Sides) {
+			s.BackSector = l.Sides[back].Sector
+		}
+	}
+
+	// SubSectors
+	for i := range l.SubSectors {
+		s := &l.SubSectors[i] // Point to element
+		start := max(s.StartLineSegment, 0)
+		end := min(s.StartLineSegment+s.numLineSegments, len(l.LineSegments))
+		for j := start; j < end; j++ {
+			s.LineSegments = append(s.LineSegments, l.LineSegments[j])
+		}
+		for _, seg := range s.LineSegments {
+			if seg.Side != nil {
+				s.Sector = seg.Side.Sector
+				break
+			}
+		}
+	}
+
+	// Nodes
+	l.RootNode = nil
+	if len(l.Nodes) > 0 {
+		l.RootNode = &l.Nodes[len(l.Nodes)-1]
+	}
+	for i := range l.Nodes {
+		n := &l.Nodes[i] // Point to element
+		n.ChildR = l.nodeChildRef(n.ChildNumR)
+		n.ChildL = l.nodeChildRef(n.ChildNumL)
+	}
+	setSubSectorPolygons(l)
+}
+
+// nodeChildRef returns the node or subsector a node child refers to, or nil if it is out of range
+func (l *Level) nodeChildRef(c int) BSPMember {
+	switch {
+	case c < 0 && c&math.MaxInt32 < len(l.SubSectors):
+		return &l.SubSectors[c&math.MaxInt32]
+	case c >= 0 && c < len(l.Nodes):
+		return &l.Nodes[c]
+	}
+	return nil
+}
+
 // MaxRadius is for precalculated sector block boxes
 // the spider demon is larger, but don't have any moving sectors nearby
 const MaxRadius = 32
@@ -1366,7 +1902,7 @@ func (b *BoundBox) add(v Vertex) {
 	b.Left = min(b.Left, v.X)
 	b.Right = max(b.Right, v.X)
 	b.Bottom = min(b.Bottom, v.Y)
-	b.Top = min(b.Top, v.Y)
+	b.Top = max(b.Top, v.Y)
 }
 
 // func bBoxFromBin(b binBBox) BBox {
@@ -1407,10 +1943,11 @@ func (w *WAD) readThings(lumpInfo *LumpInfo) ([]Thing, error) {
 	logger.Println("Reading Things ...")
 
 	// Read things lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binThing{}))
 	binThings := make([]binThing, count)
 	things := make([]Thing, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binThings); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binThings); err != nil {
 		return nil, err
 	}
 
@@ -1426,6 +1963,52 @@ func (w *WAD) readThings(lumpInfo *LumpInfo) ([]Thing, error) {
 			Skill4and5:      t.Options&4 != 0,
 			Ambush:          t.Options&8 != 0,
 			MultiplayerOnly: t.Options&0x10 != 0,
+			otherFlags:      int(t.Options) &^ 0x1f,
+		}
+	}
+	logger.Printf("Read %v things", len(things))
+	return things, nil
+}
+
+// readHexenThings reads a Hexen format THINGS lump
+func (w *WAD) readHexenThings(lumpInfo *LumpInfo) ([]Thing, error) {
+	logger.Println("Reading Hexen Things ...")
+
+	// Read things lump
+	reader := w.lumpReader(lumpInfo)
+	count := lumpInfo.Size / int(unsafe.Sizeof(binHexenThing{}))
+	binThings := make([]binHexenThing, count)
+	things := make([]Thing, count)
+	if err := binary.Read(reader, binary.LittleEndian, binThings); err != nil {
+		return nil, err
+	}
+
+	// Translate to canonical
+	for i, t := range binThings {
+		things[i] = Thing{
+			X:               int(t.X),
+			Y:               int(t.Y),
+			Angle:           degreesToRadians(t.Angle),
+			Type:            int(t.Type),
+			Skill1and2:      t.Options&1 != 0,
+			Skill3:          t.Options&2 != 0,
+			Skill4and5:      t.Options&4 != 0,
+			Ambush:          t.Options&8 != 0,
+			MultiplayerOnly: t.Options&0x100 == 0,
+			TID:             int(t.TID),
+			Z:               int(t.Z),
+			Special:         int(t.Special),
+			Dormant:         t.Options&0x10 != 0,
+			Fighter:         t.Options&0x20 != 0,
+			Cleric:          t.Options&0x40 != 0,
+			Mage:            t.Options&0x80 != 0,
+			SinglePlayer:    t.Options&0x100 != 0,
+			Cooperative:     t.Options&0x200 != 0,
+			Deathmatch:      t.Options&0x400 != 0,
+			otherFlags:      int(t.Options) &^ 0x7ff,
+		}
+		for j, arg := range t.Args {
+			things[i].Args[j] = int(arg)
 		}
 	}
 	logger.Printf("Read %v things", len(things))
@@ -1436,10 +2019,11 @@ func (w *WAD) readLines(lumpInfo *LumpInfo) ([]Line, error) {
 	logger.Println("Reading Lines ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binLine{}))
 	binLine := make([]binLine, count)
 	lines := make([]Line, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binLine); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binLine); err != nil {
 		return nil, err
 	}
 
@@ -1461,6 +2045,51 @@ func (w *WAD) readLines(lumpInfo *LumpInfo) ([]Line, error) {
 			SectorTagNum:           int(line.SectorTag),
 			SideRNum:               int(line.SideR),
 			SideLNum:               int(line.SideL),
+			otherFlags:             int(line.Flags) &^ 0x1ff,
+		}
+	}
+
+	logger.Printf("Read %v lines", len(lines))
+
+	return lines, nil
+}
+
+// readHexenLines reads a Hexen format LINEDEFS lump
+func (w *WAD) readHexenLines(lumpInfo *LumpInfo) ([]Line, error) {
+	logger.Println("Reading Hexen Lines ...")
+
+	// Read lump
+	reader := w.lumpReader(lumpInfo)
+	count := lumpInfo.Size / int(unsafe.Sizeof(binHexenLine{}))
+	binLines := make([]binHexenLine, count)
+	lines := make([]Line, count)
+	if err := binary.Read(reader, binary.LittleEndian, binLines); err != nil {
+		return nil, err
+	}
+
+	// Translate to canonical
+	for i, line := range binLines {
+		lines[i] = Line{
+			V1Num:                  int(line.VertexStart),
+			V2Num:                  int(line.VertexEnd),
+			BlockPlayerAndMonsters: line.Flags&1 != 0,
+			BlockMonsters:          line.Flags&2 != 0,
+			TwoSided:               line.Flags&4 != 0,
+			UpperTextureUnpegged:   line.Flags&8 != 0,
+			LowerTextureUnpegged:   line.Flags&0x10 != 0,
+			Secret:                 line.Flags&0x20 != 0,
+			BlocksSound:            line.Flags&0x40 != 0,
+			NeverMap:               line.Flags&0x80 != 0,
+			Mapped:                 line.Flags&0x100 != 0,
+			SideRNum:               int(line.SideR),
+			SideLNum:               int(line.SideL),
+			Special:                int(line.Special),
+			Repeatable:             line.Flags&0x200 != 0,
+			Activation:             Activation(line.Flags >> 10 & 7),
+			otherFlags:             int(line.Flags) &^ 0x1fff,
+		}
+		for j, arg := range line.Args {
+			lines[i].Args[j] = int(arg)
 		}
 	}
 
@@ -1473,10 +2102,11 @@ func (w *WAD) readSides(lumpInfo *LumpInfo) ([]Side, error) {
 	logger.Println("Reading Sides ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binSide{}))
 	binSides := make([]binSide, count)
 	sides := make([]Side, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binSides); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binSides); err != nil {
 		return nil, err
 	}
 
@@ -1490,9 +2120,9 @@ func (w *WAD) readSides(lumpInfo *LumpInfo) ([]Side, error) {
 			LowerTextureName:  s.LowerTexture.String(),
 			SectorNum:         int(s.SectorNum),
 		}
-		sides[i].UpperTexture = w.Textures[sides[i].UpperTextureName]
-		sides[i].MiddleTexture = w.Textures[sides[i].MiddleTextureName]
-		sides[i].LowerTexture = w.Textures[sides[i].LowerTextureName]
+		sides[i].UpperTexture = w.textureOrNil(sides[i].UpperTextureName)
+		sides[i].MiddleTexture = w.textureOrNil(sides[i].MiddleTextureName)
+		sides[i].LowerTexture = w.textureOrNil(sides[i].LowerTextureName)
 	}
 
 	logger.Printf("Read %v sides", len(sides))
@@ -1503,10 +2133,11 @@ func (w *WAD) readVertexes(lumpInfo *LumpInfo) ([]Vertex, error) {
 	logger.Println("Reading Vertexes ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binVertex{}))
 	binVertexes := make([]binVertex, count)
 	vertexes := make([]Vertex, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binVertexes); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binVertexes); err != nil {
 		return nil, err
 	}
 
@@ -1523,22 +2154,24 @@ func (w *WAD) readLineSegments(lumpInfo *LumpInfo) ([]LineSegment, error) {
 	logger.Println("Reading Line Segments ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := int(lumpInfo.Size) / int(unsafe.Sizeof(binLineSegment{}))
 	binSegments := make([]binLineSegment, count)
 	segments := make([]LineSegment, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binSegments); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binSegments); err != nil {
 		return nil, err
 	}
 
 	// Translate to canonical
 	for i, s := range binSegments {
 		segments[i] = LineSegment{
-			V1Num:   int(s.V1),
-			V2Num:   int(s.V2),
-			Angle:   wadBamToRadians(s.Angle),
-			LineNum: int(s.LineNum),
-			IsSideL: s.Direction == 1,
-			Offset:  float64(s.Offset),
+			V1Num:      int(s.V1),
+			V2Num:      int(s.V2),
+			Angle:      wadBamToRadians(s.Angle),
+			LineNum:    int(s.LineNum),
+			IsSideL:    s.Direction == 1,
+			Offset:     float64(s.Offset),
+			PartnerNum: -1,
 		}
 	}
 	logger.Printf("Read %v line segments", len(segments))
@@ -1550,10 +2183,11 @@ func (w *WAD) readSubSectors(lumpInfo *LumpInfo) ([]SubSector, error) {
 	logger.Println("Reading Sub Sectors ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := int(lumpInfo.Size) / int(unsafe.Sizeof(binSubSector{}))
 	binSubSectors := make([]binSubSector, count)
 	subSectors := make([]SubSector, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binSubSectors); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binSubSectors); err != nil {
 		return nil, err
 	}
 
@@ -1573,10 +2207,11 @@ func (w *WAD) readNodes(lumpInfo *LumpInfo) ([]Node, error) {
 	logger.Println("Reading Nodes ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binNode{}))
 	binNodes := make([]binNode, count)
 	nodes := make([]Node, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binNodes); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binNodes); err != nil {
 		return nil, err
 	}
 
@@ -1599,8 +2234,8 @@ func (w *WAD) readNodes(lumpInfo *LumpInfo) ([]Node, error) {
 				float64(n.BBoxL.Left),
 				float64(n.BBoxL.Right),
 			},
-			ChildNumR: int(n.ChildNumR),
-			ChildNumL: int(n.ChildNumL),
+			ChildNumR: nodeChild(n.ChildNumR),
+			ChildNumL: nodeChild(n.ChildNumL),
 		}
 	}
 	logger.Printf("Read %v nodes", len(nodes))
@@ -1612,10 +2247,11 @@ func (w *WAD) readSectors(lumpInfo *LumpInfo, sectorUser any) ([]Sector, error)
 	logger.Println("Reading Sectors ...")
 
 	// Read lump
+	reader := w.lumpReader(lumpInfo)
 	count := lumpInfo.Size / int(unsafe.Sizeof(binSector{}))
 	binSectors := make([]binSector, count)
 	sectors := make([]Sector, count)
-	if err := binary.Read(w.file, binary.LittleEndian, binSectors); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, binSectors); err != nil {
 		return nil, err
 	}
 
@@ -1636,49 +2272,64 @@ func (w *WAD) readSectors(lumpInfo *LumpInfo, sectorUser any) ([]Sector, error)
 			TagNum:             int(s.TagNum),
 			User:               &newUser,
 		}
-		sectors[i].FloorTexture = w.Flats[sectors[i].FloorTextureName]
-		sectors[i].CeilingTexture = w.Flats[sectors[i].CeilingTextureName]
+		sectors[i].FloorTexture = w.flatOrNil(sectors[i].FloorTextureName)
+		sectors[i].CeilingTexture = w.flatOrNil(sectors[i].CeilingTextureName)
 	}
 	logger.Printf("Read %v Sectors", len(sectors))
 
 	return sectors, nil
 }
 
-func (w *WAD) readReject(lumpInfo *LumpInfo) (*Reject, error) {
+func (w *WAD) readReject(lumpInfo *LumpInfo, numSectors int) (*Reject, []byte, error) {
 	logger.Println("Reading Reject ...")
 
 	// Read lump
 	lump, err := w.readLump(lumpInfo)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	reject := decodeReject(lump, numSectors)
+	logger.Printf("Read Reject table: %v sectors", len(reject))
+
+	return &reject, lump, nil
+}
 
-	numSectors := int(math.Sqrt(float64(8 * lumpInfo.Size)))
+// decodeReject unpacks a REJECT lump for a number of sectors
+func decodeReject(lump []byte, numSectors int) Reject {
+	// One bit per pair of sectors, from the low bit of each byte. Short lumps reject nothing more.
 	reject := make(Reject, numSectors)
 	for sector1 := range numSectors {
 		reject[sector1] = make([]bool, numSectors)
 		for sector2 := range numSectors {
 			cell := sector1*numSectors + sector2
 			i, j := cell/8, cell%8
-			if (lump[i] << j) > 0 {
+			if i < len(lump) && lump[i]>>j&1 != 0 {
 				reject[sector1][sector2] = true
 			}
 		}
 	}
-	logger.Printf("Read Reject table: %v sectors", len(reject))
-
-	return &reject, nil
-
+	return reject
 }
 
-func (w *WAD) readBlockmap(lumpInfo *LumpInfo) (*BlockMap, error) {
+func (w *WAD) readBlockmap(lumpInfo *LumpInfo) (*BlockMap, []byte, error) {
 	logger.Println("Reading Block Map ...")
 
 	// Read lump
 	lump, err := w.readLump(lumpInfo)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	blockMap, err := decodeBlockMap(lump)
+	if err != nil {
+		return nil, nil, err
 	}
+	logger.Printf("Read %v blocks", len(blockMap.Blocks))
+
+	return blockMap, lump, nil
+}
+
+// decodeBlockMap unpacks a BLOCKMAP lump
+func decodeBlockMap(lump []byte) (*BlockMap, error) {
 	buffer := bytes.NewBuffer(lump)
 
 	// Read header
@@ -1701,64 +2352,110 @@ func (w *WAD) readBlockmap(lumpInfo *LumpInfo) (*BlockMap, error) {
 		NumRows:    int(header.Rows),
 	}
 
-	// Populate block lists
+	// Populate block lists, up to the -1 that ends each
+	leadingZeros := true
 	for _, o := range offsets {
-		reader := bytes.NewBuffer(lump[2*o:])
-		var binlineNum binBlockLineNum
+		if 2*int(uint16(o)) >= len(lump) {
+			return nil, fmt.Errorf("block list offset %v out of range", uint16(o))
+		}
+		reader := bytes.NewBuffer(lump[2*int(uint16(o)):])
 		lineNums := make([]int, 0)
-		for binlineNum != 0xffff {
+		for {
+			var binlineNum binBlockLineNum
 			if err := binary.Read(reader, binary.LittleEndian, &binlineNum); err != nil {
 				return nil, err
 			}
-			if binlineNum != 0 && binlineNum != 0xffff {
-				lineNums = append(lineNums, int(binlineNum))
+			if binlineNum == 0xffff {
+				break
 			}
+			lineNums = append(lineNums, int(binlineNum))
 		}
-		// if len(blockList) > 0 {
+		leadingZeros = leadingZeros && len(lineNums) > 0 && lineNums[0] == 0
 		blockMap.Blocks = append(blockMap.Blocks, Block{LineNums: lineNums})
-		// }
 	}
-	logger.Printf("Read %v blocks", len(blockMap.Blocks))
 
+	// Node builders usually start every list with a 0, which EncodeBlockMap writes back, so it is
+	// discarded. If any list doesn't start with one, the builder left them out, and a first 0 is
+	// line 0.
+	if leadingZeros {
+		for i := range blockMap.Blocks {
+			blockMap.Blocks[i].LineNums = blockMap.Blocks[i].LineNums[1:]
+		}
+	}
 	return &blockMap, nil
 }
 
-// seekLumpName
-func (w *WAD) seekLumpName(name string) error {
-	pnamesLump, ok := w.lumpNums[name]
+// lumpReaderName returns a reader over the named lump
+func (w *WAD) lumpReaderName(name string) (*io.SectionReader, error) {
+	lumpNum, ok := w.lumpNums[name]
 	if !ok {
-		return errors.New("lump not found")
+		return nil, fmt.Errorf("%v lump not found", name)
 	}
-	lumpInfo := w.lumpInfos[pnamesLump]
-	return w.seek(int64(lumpInfo.Filepos))
+	return w.lumpReader(&w.lumpInfos[lumpNum]), nil
 }
 
-// seek
-func (w *WAD) seek(offset int64) error {
-	off, err := w.file.Seek(offset, io.SeekStart)
-	if err != nil {
-		return err
-	}
-	if off != offset {
-		return fmt.Errorf("seek failed")
-	}
-	return nil
+// lumpReader returns a reader over the lump's data. Each reader has its own offset, so readers
+// never disturb one another.
+func (w *WAD) lumpReader(lumpInfo *LumpInfo) *io.SectionReader {
+	return io.NewSectionReader(lumpInfo.archive.r, int64(lumpInfo.Filepos), int64(lumpInfo.Size))
 }
 
 // Read entire lump
 func (w *WAD) readLump(lumpInfo *LumpInfo) ([]byte, error) {
-	if err := w.seek(int64(lumpInfo.Filepos)); err != nil {
-		return nil, err
-	}
 	lump := make([]byte, lumpInfo.Size)
-	n, err := w.file.Read(lump)
+	if _, err := io.ReadFull(w.lumpReader(lumpInfo), lump); err != nil {
+		return nil, fmt.Errorf("truncated lump %v: %w", lumpInfo.Name, err)
+	}
+	return lump, nil
+}
+
+// cached returns the named resource from a resource map, calling load and storing its result on
+// a miss. The lock is not held while loading, so two goroutines may load the same resource at
+// once, but only the first result is kept.
+func cached[T any](w *WAD, m map[string]*T, name string, load func() (*T, error)) (*T, error) {
+	w.mu.RLock()
+	v, ok := m[name]
+	w.mu.RUnlock()
+	if ok {
+		return v, nil
+	}
+	v, err := load()
 	if err != nil {
 		return nil, err
 	}
-	if n != int(lumpInfo.Size) {
-		return nil, fmt.Errorf("truncated lump")
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existing, ok := m[name]; ok {
+		return existing, nil
 	}
-	return lump, nil
+	m[name] = v
+	return v, nil
+}
+
+// parallelFor calls fn for each i from 0 to n-1, using up to workers goroutines
+func parallelFor(n, workers int, fn func(i int)) {
+	if workers <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 }
 
 // degreesToRadians
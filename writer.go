@@ -0,0 +1,319 @@
+package wad
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// ArchiveType selects the magic written to a WAD header
+type ArchiveType int
+
+const (
+	ArchivePWAD ArchiveType = iota
+	ArchiveIWAD
+)
+
+// Lump is a named block of data held by a Writer
+type Lump struct {
+	Name string
+	Data []byte
+}
+
+// Writer builds an IWAD or PWAD archive in memory. Lumps can be added, replaced, renamed,
+// reordered and deleted, and the archive is then serialized with WriteTo.
+type Writer struct {
+	Type  ArchiveType
+	lumps []Lump
+}
+
+// Map lump names in the order Doom expects them after a map header lump. Hexen format maps add
+// BEHAVIOR and optionally SCRIPTS.
+var mapLumpNames = []string{
+	"THINGS", "LINEDEFS", "SIDEDEFS", "VERTEXES", "SEGS", "SSECTORS", "NODES", "SECTORS", "REJECT",
+	"BLOCKMAP", "BEHAVIOR", "SCRIPTS",
+}
+
+// isMapLump reports whether the named lump belongs to a map
+func isMapLump(name string) bool {
+	return slices.Contains(mapLumpNames, name)
+}
+
+// NewWriter returns an empty archive of the given type
+func NewWriter(t ArchiveType) *Writer {
+	return &Writer{Type: t}
+}
+
+// NewWriterFrom reads an existing IWAD or PWAD from size bytes of r into a Writer, so that it can
+// be patched and saved.
+func NewWriterFrom(r io.ReaderAt, size int64) (*Writer, error) {
+	a := &archive{name: "reader", r: r, size: size}
+	if err := a.readHeader(); err != nil {
+		return nil, err
+	}
+	w := &WAD{archives: []*archive{a}}
+	if err := w.readInfoTables(a); err != nil {
+		return nil, err
+	}
+	wr := &Writer{Type: ArchivePWAD}
+	if a.isIWAD {
+		wr.Type = ArchiveIWAD
+	}
+	for i := range w.lumpInfos {
+		data, err := w.readLump(&w.lumpInfos[i])
+		if err != nil {
+			return nil, err
+		}
+		wr.lumps = append(wr.lumps, Lump{Name: w.lumpInfos[i].Name, Data: data})
+	}
+	return wr, nil
+}
+
+// Len returns the number of lumps in the archive
+func (wr *Writer) Len() int {
+	return len(wr.lumps)
+}
+
+// Lumps returns the lumps in archive order. The slice must not be modified.
+func (wr *Writer) Lumps() []Lump {
+	return wr.lumps
+}
+
+// Lump returns the lump at index i
+func (wr *Writer) Lump(i int) (*Lump, error) {
+	if err := wr.checkIndex(i); err != nil {
+		return nil, err
+	}
+	return &wr.lumps[i], nil
+}
+
+// Index returns the index of the last lump with the given name, matching Doom's lookup rule, or
+// -1 if there is none.
+func (wr *Writer) Index(name string) int {
+	name = strings.ToUpper(name)
+	for i := len(wr.lumps) - 1; i >= 0; i-- {
+		if wr.lumps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends a lump and returns its index
+func (wr *Writer) Add(name string, data []byte) (int, error) {
+	return len(wr.lumps), wr.Insert(len(wr.lumps), name, data)
+}
+
+// Insert inserts a lump before index i. An index equal to Len appends.
+func (wr *Writer) Insert(i int, name string, data []byte) error {
+	if i < 0 || i > len(wr.lumps) {
+		return fmt.Errorf("lump index %v out of range", i)
+	}
+	name, err := lumpName(name)
+	if err != nil {
+		return err
+	}
+	wr.lumps = slices.Insert(wr.lumps, i, Lump{Name: name, Data: data})
+	return nil
+}
+
+// Replace replaces the data of the last lump with the given name, or appends a new lump if there
+// is none.
+func (wr *Writer) Replace(name string, data []byte) error {
+	if i := wr.Index(name); i >= 0 {
+		wr.lumps[i].Data = data
+		return nil
+	}
+	_, err := wr.Add(name, data)
+	return err
+}
+
+// Rename renames the lump at index i
+func (wr *Writer) Rename(i int, name string) error {
+	if err := wr.checkIndex(i); err != nil {
+		return err
+	}
+	name, err := lumpName(name)
+	if err != nil {
+		return err
+	}
+	wr.lumps[i].Name = name
+	return nil
+}
+
+// Move moves the lump at index from so that it ends up at index to
+func (wr *Writer) Move(from, to int) error {
+	if err := wr.checkIndex(from); err != nil {
+		return err
+	}
+	if err := wr.checkIndex(to); err != nil {
+		return err
+	}
+	lump := wr.lumps[from]
+	wr.lumps = slices.Delete(wr.lumps, from, from+1)
+	wr.lumps = slices.Insert(wr.lumps, to, lump)
+	return nil
+}
+
+// Delete removes the lump at index i
+func (wr *Writer) Delete(i int) error {
+	if err := wr.checkIndex(i); err != nil {
+		return err
+	}
+	wr.lumps = slices.Delete(wr.lumps, i, i+1)
+	return nil
+}
+
+// NamespaceRange returns the indexes of the first start marker and the following end marker,
+// such as F_START and F_END.
+func (wr *Writer) NamespaceRange(start, end string) (int, int, bool) {
+	start, end = strings.ToUpper(start), strings.ToUpper(end)
+	for i := range wr.lumps {
+		if wr.lumps[i].Name != start {
+			continue
+		}
+		for j := i + 1; j < len(wr.lumps); j++ {
+			if wr.lumps[j].Name == end {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// AddToNamespace adds a lump just before the namespace's end marker, replacing a lump of the same
+// name already in the namespace. The markers are appended if the namespace does not exist yet.
+func (wr *Writer) AddToNamespace(start, end, name string, data []byte) error {
+	name, err := lumpName(name)
+	if err != nil {
+		return err
+	}
+	first, last, ok := wr.NamespaceRange(start, end)
+	if !ok {
+		if _, err := wr.Add(start, nil); err != nil {
+			return err
+		}
+		if _, err := wr.Add(end, nil); err != nil {
+			return err
+		}
+		first, last = len(wr.lumps)-2, len(wr.lumps)-1
+	}
+	for i := first + 1; i < last; i++ {
+		if wr.lumps[i].Name == name {
+			wr.lumps[i].Data = data
+			return nil
+		}
+	}
+	return wr.Insert(last, name, data)
+}
+
+// MapRange returns the index of a map's header lump and the index just past its last map lump
+func (wr *Writer) MapRange(name string) (int, int, bool) {
+	i := wr.Index(name)
+	if i < 0 {
+		return 0, 0, false
+	}
+	j := i + 1
+	if j < len(wr.lumps) && wr.lumps[j].Name == "TEXTMAP" {
+		for j < len(wr.lumps) && wr.lumps[j].Name != "ENDMAP" {
+			j++
+		}
+		return i, min(j+1, len(wr.lumps)), true
+	}
+	for j < len(wr.lumps) && isMapLump(wr.lumps[j].Name) {
+		j++
+	}
+	return i, j, true
+}
+
+// SetMap adds a map header lump followed by the map's lumps, replacing any existing map of the
+// same name in place.
+func (wr *Writer) SetMap(name string, lumps []Lump) error {
+	name, err := lumpName(name)
+	if err != nil {
+		return err
+	}
+	mapLumps := []Lump{{Name: name}}
+	for _, l := range lumps {
+		lname, err := lumpName(l.Name)
+		if err != nil {
+			return err
+		}
+		mapLumps = append(mapLumps, Lump{Name: lname, Data: l.Data})
+	}
+	if first, last, ok := wr.MapRange(name); ok {
+		wr.lumps = slices.Replace(wr.lumps, first, last, mapLumps...)
+		return nil
+	}
+	wr.lumps = append(wr.lumps, mapLumps...)
+	return nil
+}
+
+// DeleteMap removes a map header lump and the map's lumps
+func (wr *Writer) DeleteMap(name string) error {
+	first, last, ok := wr.MapRange(name)
+	if !ok {
+		return fmt.Errorf("map %v not found", name)
+	}
+	wr.lumps = slices.Delete(wr.lumps, first, last)
+	return nil
+}
+
+// WriteTo serializes the archive: a header, the lump data, and then the directory.
+func (wr *Writer) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	magic := [4]byte{'P', 'W', 'A', 'D'}
+	if wr.Type == ArchiveIWAD {
+		magic[0] = 'I'
+	}
+
+	// Lay out lump data after the header, and the directory after the data
+	infos := make([]binLumpInfo, len(wr.lumps))
+	pos := int64(unsafe.Sizeof(binHeader{}))
+	for i, l := range wr.lumps {
+		if pos+int64(len(l.Data)) > 1<<31-1 {
+			return 0, fmt.Errorf("archive too large")
+		}
+		infos[i] = binLumpInfo{Filepos: int32(pos), Size: int32(len(l.Data))}
+		copy(infos[i].Name[:], l.Name)
+		pos += int64(len(l.Data))
+	}
+	header := binHeader{Magic: magic, NumLumps: int32(len(wr.lumps)), InfoTableOfs: int32(pos)}
+
+	// Write header, data and directory
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return 0, err
+	}
+	for _, l := range wr.lumps {
+		if _, err := bw.Write(l.Data); err != nil {
+			return 0, err
+		}
+	}
+	if err := binary.Write(bw, binary.LittleEndian, infos); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return pos + int64(len(infos))*int64(unsafe.Sizeof(binLumpInfo{})), nil
+}
+
+// checkIndex
+func (wr *Writer) checkIndex(i int) error {
+	if i < 0 || i >= len(wr.lumps) {
+		return fmt.Errorf("lump index %v out of range", i)
+	}
+	return nil
+}
+
+// lumpName validates a lump name and converts it to upper case
+func lumpName(name string) (string, error) {
+	if name == "" || len(name) > len(String8{}) {
+		return "", fmt.Errorf("invalid lump name %q", name)
+	}
+	return strings.ToUpper(name), nil
+}